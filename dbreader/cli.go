@@ -0,0 +1,291 @@
+/*
+Package main provides the command-line interface of the LND Database Reader.
+
+Without arguments the reader behaves like the container entrypoint always did:
+an initial sync followed by a sync every SYNC_INTERVAL_MINUTES. The sync
+subcommand makes the mode explicit for systemd timers, cron jobs and scripts:
+
+	lnd-dbreader sync --loop      sync now and then on every interval (default)
+	lnd-dbreader sync --watch     sync now and then whenever channel.db changed
+	lnd-dbreader sync --once      sync once and exit with a meaningful exit code
+	lnd-dbreader sync --dry-run   copy and read the graph, count rows, write nothing
+
+The export subcommand writes the graph to files instead, see export.go.
+
+Configuration is still read from the environment variables listed in main.go.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"lnd-dbreader/db"
+)
+
+// Process exit codes
+const (
+	exitSuccess = 0
+	exitFailed  = 1
+	exitUsage   = 2
+)
+
+// usageText describes the available subcommands
+const usageText = `Usage: lnd-dbreader [command] [flags]
+
+Commands:
+  sync    Import the LND channel graph into MySQL, PostgreSQL or SQLite (default)
+  export  Write the channel graph to files for analysis tools
+
+Run "lnd-dbreader <command> -h" for the flags of a command.
+`
+
+// runCommand dispatches the command line and returns the process exit code
+func runCommand(args []string) int {
+	command := "sync"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "sync":
+		return runSync(args)
+	case "export":
+		return runExport(args)
+	case validateCopyCommand:
+		return runValidateCopy(args)
+	case "help":
+		fmt.Fprint(os.Stdout, usageText)
+		return exitSuccess
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usageText)
+		return exitUsage
+	}
+}
+
+// runSync parses the sync flags and runs the selected sync mode
+func runSync(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	once := flags.Bool("once", false, "run a single sync and exit with status 1 if it fails")
+	loop := flags.Bool("loop", false, "sync now and then every SYNC_INTERVAL_MINUTES (default)")
+	watch := flags.Bool("watch", false, "like --loop, but sync when channel.db changed (SYNC_TRIGGER=watch)")
+	dryRun := flags.Bool("dry-run", false, "read the graph and count rows without writing to the database")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		return exitUsage
+	}
+	if *once && *loop {
+		fmt.Fprintln(os.Stderr, "--once and --loop are mutually exclusive")
+		return exitUsage
+	}
+	if *once && *watch {
+		fmt.Fprintln(os.Stderr, "--once and --watch are mutually exclusive")
+		return exitUsage
+	}
+	if *dryRun && (*loop || *watch) {
+		fmt.Fprintln(os.Stderr, "--dry-run always runs once and cannot be combined with --loop or --watch")
+		return exitUsage
+	}
+
+	log.Printf("Starting %s %s", appName, appVersion)
+
+	// Load configuration
+	config := loadConfig()
+	if *watch {
+		config.SyncTrigger = syncTriggerWatch
+	}
+	logConfig(config)
+
+	// Set up graceful shutdown; SIGINT and SIGTERM abort a running sync
+	ctx, cancel := setupGracefulShutdown()
+	defer cancel()
+
+	if *dryRun {
+		if err := dryRunSync(ctx, config); err != nil {
+			log.Printf("❌ ERROR during dry run: %v", err)
+			return exitFailed
+		}
+		log.Printf("✅ Dry run completed successfully!")
+		return exitSuccess
+	}
+
+	// Connect to the storage backend
+	store, err := openStorage(config)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		return exitFailed
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Warning: Failed to close %s connection: %v", store.Describe(), err)
+		}
+	}()
+
+	log.Printf("Writing the graph to %s", store.Describe())
+
+	// Remove database copies left behind by crashed runs
+	if lockFile, err := acquireWorkDirLock(config.WorkDir); err != nil {
+		log.Printf("Warning: Skipping stale copy cleanup: %v", err)
+	} else {
+		if err := cleanupStaleCopies(config.WorkDir); err != nil {
+			log.Printf("Warning: Failed to clean up stale copies: %v", err)
+		}
+		releaseWorkDirLock(lockFile)
+	}
+
+	if *once {
+		printSyncBanner(fmt.Sprintf("SYNC - %s", time.Now().Format("2006-01-02 15:04:05")))
+
+		if err := syncToStorage(ctx, config, store); err != nil {
+			log.Printf("❌ ERROR during sync: %v", err)
+			return exitFailed
+		}
+		log.Printf("✅ Sync completed successfully!")
+		return exitSuccess
+	}
+
+	if !syncLoop(ctx, config, store) {
+		return exitFailed
+	}
+	return exitSuccess
+}
+
+// logConfig logs the effective configuration without the database password
+func logConfig(config *Config) {
+	log.Printf("Configuration:")
+	log.Printf("  LND DB Path: %s", config.LNDDBPath)
+	log.Printf("  Storage Backend: %s", config.StorageBackend)
+	switch config.StorageBackend {
+	case db.BackendPostgres:
+		log.Printf("  PostgreSQL: %s:***@%s:%s/%s (sslmode=%s)",
+			config.Postgres.User, config.Postgres.Host, config.Postgres.Port, config.Postgres.Database, config.Postgres.SSLMode)
+	case db.BackendSQLite:
+		log.Printf("  SQLite: %s (one file per %s)", config.SQLite.Dir, config.SQLite.FilePer)
+	default:
+		log.Printf("  MySQL: %s:***@tcp(%s:%s)/%s",
+			config.MySQL.User, config.MySQL.Host, config.MySQL.Port, config.MySQL.Database)
+	}
+	log.Printf("  Sync Interval: %v", config.SyncInterval)
+	log.Printf("  Verify Signatures: %v", config.VerifySignatures)
+	log.Printf("  DB Work Dir: %s", config.WorkDir)
+	log.Printf("  Atomic Sync: %v", config.AtomicSync)
+	log.Printf("  Snapshot Mode: %s", config.SnapshotMode)
+	log.Printf("  Graph Events: %v", config.GraphEvents)
+	log.Printf("  Incremental Sync: %v", config.IncrementalSync)
+	log.Printf("  Sync Trigger: %s", config.SyncTrigger)
+	if config.SyncTrigger == syncTriggerWatch {
+		log.Printf("  Watch Quiet Period: %v", config.WatchQuiet)
+		log.Printf("  Watch Min Interval: %v", config.WatchMinInterval)
+	}
+}
+
+// printSyncBanner separates the output of consecutive syncs
+func printSyncBanner(title string) {
+	separator := strings.Repeat("=", 80)
+	fmt.Printf("\n%s\n", separator)
+	fmt.Printf("%s\n", title)
+	fmt.Printf("%s\n", separator)
+}
+
+// syncLoop runs an initial sync and then one sync per trigger until ctx is cancelled.
+// It reports false when the configured trigger cannot be set up.
+func syncLoop(ctx context.Context, config *Config, store *storage) bool {
+	trigger, err := newSyncTrigger(config)
+	if err != nil {
+		log.Printf("Failed to set up sync trigger: %v", err)
+		return false
+	}
+	defer func() {
+		if err := trigger.Close(); err != nil {
+			log.Printf("Warning: Failed to close sync trigger: %v", err)
+		}
+	}()
+
+	// Run initial sync
+	printSyncBanner(fmt.Sprintf("INITIAL SYNC - %s", time.Now().Format("2006-01-02 15:04:05")))
+
+	lastSync := time.Now()
+	if err := syncToStorage(ctx, config, store); ctx.Err() != nil {
+		log.Printf("Initial sync interrupted by shutdown")
+	} else if err != nil {
+		log.Printf("ERROR during initial sync: %v", err)
+		log.Printf("Will retry %s", trigger.Describe())
+	} else {
+		log.Printf("✅ Initial sync completed successfully!")
+	}
+
+	// Start continuous sync loop
+	syncCount := 1
+
+	for trigger.Wait(ctx, lastSync) {
+		syncCount++
+		printSyncBanner(fmt.Sprintf("SYNC #%d - %s", syncCount, time.Now().Format("2006-01-02 15:04:05")))
+
+		lastSync = time.Now()
+		if err := syncToStorage(ctx, config, store); ctx.Err() != nil {
+			log.Printf("Sync #%d interrupted by shutdown", syncCount)
+		} else if err != nil {
+			log.Printf("❌ ERROR during sync #%d: %v", syncCount, err)
+			log.Printf("Will retry %s", trigger.Describe())
+		} else {
+			log.Printf("✅ Sync #%d completed successfully!", syncCount)
+			log.Printf("Next sync %s", trigger.Describe())
+		}
+	}
+
+	log.Printf("Shutdown signal received, exiting gracefully")
+	return true
+}
+
+// dryRunSync copies and opens the graph like a sync, counts the rows each table
+// would receive and logs them. The database is neither contacted nor written.
+func dryRunSync(ctx context.Context, config *Config) error {
+	log.Printf("Starting dry run, nothing will be written to the database")
+
+	run := db.NewSyncRun(0, time.Time{})
+
+	source, err := openGraphCopy(ctx, config, run)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	err = run.TimePhase("count", func() error {
+		return db.CountGraph(ctx, source.graph, source.indexes, run.Tables)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	tables := make([]string, 0, len(run.Tables))
+	for table := range run.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	log.Printf("Rows that a sync would write:")
+	for _, table := range tables {
+		log.Printf("  %s: %d", table, run.Tables[table].Read)
+	}
+
+	log.Printf("Phase durations:")
+	for _, phase := range []string{"copy", "open_graph", "count"} {
+		log.Printf("  %s: %v", phase, run.Phases[phase].Round(time.Millisecond))
+	}
+
+	return nil
+}
@@ -1,327 +1,445 @@
 /*
-Package db provides database operations for importing LND graph data into MySQL.
+Package db provides database operations for importing LND graph data into SQL.
 
 This package handles the import of channel announcements, node announcements,
-and node addresses from LND v0.19.1 graph database into MySQL for analysis
-and monitoring purposes.
+and node addresses from LND v0.19.1 graph database into MySQL or PostgreSQL
+for analysis and monitoring purposes.
 */
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net"
-	"strconv"
-	"strings"
 
-	"github.com/lightningnetwork/lnd/lnwire"
 	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnwire"
 	"lnd-dbreader/models"
 )
 
-const (
-	// batchSize defines the number of records to process in a single database transaction
-	batchSize = 5000
-)
+// SendChannelAnnouncements imports all channel announcements from the LND graph.
+// With an incremental filter, unchanged channels and policies are left to TouchUnchanged.
+// A non-nil current state collects every channel for the graph events.
+func SendChannelAnnouncements(ctx context.Context, graph models.ChannelGraph, session *Session, filter *IncrementalFilter, current *GraphState, stats SyncStats) error {
+	log.Printf("Importing channel announcements to %s", session.sink.Name())
 
-// SendChannelAnnouncements imports all channel announcements from the LND graph to MySQL
-func SendChannelAnnouncements(graph models.ChannelGraph, db *sql.DB) error {
-	log.Printf("Importing channel announcements to MySQL")
+	count := 0
+	policyCount := 0
 
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
+	// Channels whose AuthProof holds unparsable signatures are stored without
+	// signatures and marked invalid once their rows are written
+	var invalidProofs [][]interface{}
 
-	var values []interface{}
-	var placeholders []string
-	count := 0
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		announcements := newBatchWriter(ctx, session.sink, tx, channelAnnouncementsTable, stats)
+		policies := newBatchWriter(ctx, session.sink, tx, channelPoliciesTable, stats)
+		policyUpdates := newBatchWriter(ctx, session.sink, tx, channelPolicyUpdatesTable, stats)
 
-	err = graph.ForEachChannel(func(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) error {
-		// Create channel announcement wrapper
-		chanAnn := models.CustomChannelAnnouncement{
-			ChannelAnnouncement1: &lnwire.ChannelAnnouncement1{
-				ChainHash:       edgeInfo.ChainHash,
-				ShortChannelID:  lnwire.NewShortChanIDFromInt(edgeInfo.ChannelID),
-				NodeID1:         edgeInfo.NodeKey1Bytes,
-				NodeID2:         edgeInfo.NodeKey2Bytes,
-				BitcoinKey1:     edgeInfo.BitcoinKey1Bytes,
-				BitcoinKey2:     edgeInfo.BitcoinKey2Bytes,
-				ExtraOpaqueData: edgeInfo.ExtraOpaqueData,
-			},
-		}
+		err := graph.ForEachChannel(func(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			current.addChannel(edgeInfo, c1, c2)
+
+			shortChannelIDInt := edgeInfo.ChannelID
+			node1Bytes := edgeInfo.NodeKey1Bytes
+			node2Bytes := edgeInfo.NodeKey2Bytes
+
+			if filter.channelChanged(edgeInfo) {
+				validProof, err := addChannelAnnouncement(announcements, edgeInfo)
+				if err != nil {
+					return err
+				}
+				if !validProof {
+					invalidProofs = append(invalidProofs, []interface{}{shortChannelIDInt})
+				}
+				count++
+			} else {
+				filter.skipChannel(shortChannelIDInt)
+			}
+
+			// Collect both directional policies; c1 belongs to node 1, c2 to node 2
+			for direction, policy := range []*models.ChannelEdgePolicy{c1, c2} {
+				if policy == nil {
+					continue
+				}
+
+				if !filter.policyChanged(shortChannelIDInt, direction, policy.LastUpdate) {
+					filter.skipPolicy(shortChannelIDInt, direction)
+					continue
+				}
+
+				advertisingNode := node1Bytes
+				if direction == 1 {
+					advertisingNode = node2Bytes
+				}
+
+				policyValues := []interface{}{
+					shortChannelIDInt,
+					direction,
+					hex.EncodeToString(advertisingNode[:]),
+					uint64(policy.FeeBaseMSat),
+					uint64(policy.FeeProportionalMillionths),
+					policy.TimeLockDelta,
+					uint64(policy.MinHTLC),
+					uint64(policy.MaxHTLC),
+					uint8(policy.MessageFlags),
+					uint8(policy.ChannelFlags),
+					policy.IsDisabled(),
+					policy.LastUpdate.Unix(),
+				}
+
+				if err := policies.Add(policyValues...); err != nil {
+					return err
+				}
+				if err := policyUpdates.Add(policyValues...); err != nil {
+					return err
+				}
+
+				policyCount++
+			}
 
-		// Serialize to JSON
-		jsonBytes, err := json.Marshal(chanAnn)
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to marshal channel announcement to JSON: %w", err)
+			return fmt.Errorf("failed to iterate channels: %w", err)
 		}
 
-		// Extract data for database insertion
-		shortChannelIDInt := chanAnn.SCID().ToUint64()
-		node1Bytes := chanAnn.Node1KeyBytes()
-		node2Bytes := chanAnn.Node2KeyBytes()
-
-		values = append(values,
-			shortChannelIDInt,
-			hex.EncodeToString(node1Bytes[:]),
-			hex.EncodeToString(node2Bytes[:]),
-			hex.EncodeToString(edgeInfo.BitcoinKey1Bytes[:]),
-			hex.EncodeToString(edgeInfo.BitcoinKey2Bytes[:]),
-			hex.EncodeToString(edgeInfo.ExtraOpaqueData),
-			string(jsonBytes),
-		)
-		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, NOW(), NOW())")
-
-		count++
-
-		// Process batch when limit reached
-		if count%batchSize == 0 {
-			if err := executeBatchChannelAnnouncements(tx, placeholders, values); err != nil {
-				return err
-			}
-			values = nil
-			placeholders = nil
+		// Process remaining records
+		if err := flushAll(announcements, policies, policyUpdates); err != nil {
+			return err
 		}
 
-		return nil
+		return executeBatchVerificationStatus(ctx, session.sink, tx, channelVerificationRows, VerificationInvalid, invalidProofs)
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to iterate channels: %w", err)
+		return err
 	}
 
-	// Process remaining records
-	if len(values) > 0 {
-		if err := executeBatchChannelAnnouncements(tx, placeholders, values); err != nil {
-			return err
-		}
+	if len(invalidProofs) > 0 {
+		log.Printf("Stored %d channel announcements with an unparsable authentication proof as invalid", len(invalidProofs))
 	}
-
 	log.Printf("Successfully imported %d channel announcements", count)
+	log.Printf("Successfully imported %d channel policies", policyCount)
 	return nil
 }
 
-// executeBatchChannelAnnouncements executes a batch insert for channel announcements
-func executeBatchChannelAnnouncements(tx *sql.Tx, placeholders []string, values []interface{}) error {
-	query := `INSERT INTO channel_announcements 
-		(short_channel_id, node_id_1, node_id_2, bitcoin_key_1, bitcoin_key_2, extra_opaque_data, json_data, first_seen, last_seen) 
-		VALUES ` + strings.Join(placeholders, ",") + ` 
-		ON DUPLICATE KEY UPDATE 
-		node_id_1 = VALUES(node_id_1),
-		node_id_2 = VALUES(node_id_2), 
-		bitcoin_key_1 = VALUES(bitcoin_key_1),
-		bitcoin_key_2 = VALUES(bitcoin_key_2),
-		extra_opaque_data = VALUES(extra_opaque_data),
-		json_data = VALUES(json_data),
-		last_seen = NOW()`
-
-	_, err := tx.Exec(query, values...)
+// addChannelAnnouncement queues the announcement row of a single channel and
+// reports whether its authentication proof, if any, could be parsed
+func addChannelAnnouncement(announcements *batchWriter, edgeInfo *models.ChannelEdgeInfo) (bool, error) {
+	// Create channel announcement wrapper
+	chanAnn, err := models.NewCustomChannelAnnouncement(edgeInfo)
 	if err != nil {
-		return fmt.Errorf("failed to execute batch insert: %w", err)
+		return false, fmt.Errorf("failed to rebuild channel announcement %d: %w", edgeInfo.ChannelID, err)
 	}
 
-	return nil
+	// Serialize to JSON
+	jsonBytes, err := json.Marshal(chanAnn)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal channel announcement to JSON: %w", err)
+	}
+
+	// Extract data for database insertion
+	node1Bytes := chanAnn.Node1KeyBytes()
+	node2Bytes := chanAnn.Node2KeyBytes()
+
+	err = announcements.Add(
+		chanAnn.SCID().ToUint64(),
+		hex.EncodeToString(node1Bytes[:]),
+		hex.EncodeToString(node2Bytes[:]),
+		hex.EncodeToString(edgeInfo.BitcoinKey1Bytes[:]),
+		hex.EncodeToString(edgeInfo.BitcoinKey2Bytes[:]),
+		int64(edgeInfo.Capacity),
+		edgeInfo.ChannelPoint.Hash.String(),
+		edgeInfo.ChannelPoint.Index,
+		models.FeaturesHex(chanAnn.Features),
+		chanAnn.SignatureHex(chanAnn.NodeSig1),
+		chanAnn.SignatureHex(chanAnn.NodeSig2),
+		chanAnn.SignatureHex(chanAnn.BitcoinSig1),
+		chanAnn.SignatureHex(chanAnn.BitcoinSig2),
+		hex.EncodeToString(edgeInfo.ExtraOpaqueData),
+		string(jsonBytes),
+	)
+
+	return !chanAnn.InvalidAuthProof, err
 }
 
-// SendNodeAnnouncements imports all node announcements from the LND graph to MySQL
-func SendNodeAnnouncements(graph models.ChannelGraph, db *sql.DB) error {
-	log.Printf("Importing node announcements to MySQL")
+// channelAnnouncementsTable describes the upsert of channel announcements
+var channelAnnouncementsTable = &Table{
+	Name: "channel_announcements",
+	Columns: []Column{
+		{"short_channel_id", ColumnSCID},
+		{"node_id_1", ColumnKey},
+		{"node_id_2", ColumnKey},
+		{"bitcoin_key_1", ColumnKey},
+		{"bitcoin_key_2", ColumnKey},
+		{"capacity_sat", ColumnValue},
+		{"funding_txid", ColumnValue},
+		{"funding_output_index", ColumnValue},
+		{"features", ColumnValue},
+		{"node_signature_1", ColumnKey},
+		{"node_signature_2", ColumnKey},
+		{"bitcoin_signature_1", ColumnKey},
+		{"bitcoin_signature_2", ColumnKey},
+		{"extra_opaque_data", ColumnKey},
+		{"json_data", ColumnValue},
+	},
+	Key: []string{"short_channel_id", "node_id_1", "node_id_2", "bitcoin_key_1", "bitcoin_key_2"},
+	Update: []string{"node_id_1", "node_id_2", "bitcoin_key_1", "bitcoin_key_2", "capacity_sat", "funding_txid",
+		"funding_output_index", "features", "node_signature_1", "node_signature_2", "bitcoin_signature_1",
+		"bitcoin_signature_2", "extra_opaque_data", "json_data"},
+	Touch: []string{"last_seen"},
+	Clear: []string{"removed_at"},
+	Now:   []string{"first_seen", "last_seen"},
+}
 
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
+// channelPoliciesTable describes the upsert of directional channel policies
+var channelPoliciesTable = &Table{
+	Name:    "channel_policies",
+	Columns: channelPolicyColumns,
+	Key:     []string{"short_channel_id", "direction"},
+	Update: []string{"node_id", "fee_base_msat", "fee_rate_milli_msat", "time_lock_delta", "min_htlc_msat",
+		"max_htlc_msat", "message_flags", "channel_flags", "disabled", "last_update"},
+	Touch: []string{"last_seen"},
+	Clear: []string{"removed_at"},
+	Now:   []string{"first_seen", "last_seen"},
+}
+
+// channelPolicyColumns are the policy fields shared by the live policies and their history
+var channelPolicyColumns = []Column{
+	{"short_channel_id", ColumnSCID},
+	{"direction", ColumnValue},
+	{"node_id", ColumnKey},
+	{"fee_base_msat", ColumnValue},
+	{"fee_rate_milli_msat", ColumnValue},
+	{"time_lock_delta", ColumnValue},
+	{"min_htlc_msat", ColumnValue},
+	{"max_htlc_msat", ColumnValue},
+	{"message_flags", ColumnValue},
+	{"channel_flags", ColumnValue},
+	{"disabled", ColumnValue},
+	{"last_update", ColumnUnixTime},
+}
+
+// channelPolicyUpdatesTable describes the insert that appends policy versions not
+// yet in the history. The unique key over the policy fields makes unchanged
+// policies a no-op.
+var channelPolicyUpdatesTable = &Table{
+	Name:    "channel_policy_updates",
+	Columns: channelPolicyColumns,
+	Key: []string{"short_channel_id", "direction", "last_update", "fee_base_msat", "fee_rate_milli_msat",
+		"time_lock_delta", "min_htlc_msat", "max_htlc_msat", "message_flags", "channel_flags"},
+	Now: []string{"recorded_at"},
+}
+
+// SendNodeAnnouncements imports all node announcements from the LND graph.
+// With an incremental filter, unchanged nodes are left to TouchUnchanged.
+// A non-nil current state collects every node for the graph events.
+func SendNodeAnnouncements(ctx context.Context, graph models.ChannelGraph, session *Session, filter *IncrementalFilter, current *GraphState, stats SyncStats) error {
+	log.Printf("Importing node announcements to %s", session.sink.Name())
 
-	var values []interface{}
-	var placeholders []string
 	count := 0
+	featureCount := 0
 
-	err = graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
-		node := nodeTx.Node()
-		
-		// Create node alias
-		alias, err := lnwire.NewNodeAlias(node.Alias)
-		if err != nil {
-			return fmt.Errorf("failed to create node alias: %w", err)
-		}
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		announcements := newBatchWriter(ctx, session.sink, tx, nodeAnnouncementsTable, stats)
+		features := newBatchWriter(ctx, session.sink, tx, nodeFeaturesTable, stats)
 
-		// Create node announcement wrapper
-		nodeAnn := models.CustomNodeAnnouncement{
-			NodeAnnouncement: lnwire.NodeAnnouncement{
-				Features:        lnwire.NewRawFeatureVector(),
-				Timestamp:       uint32(node.LastUpdate.Unix()),
-				NodeID:          node.PubKeyBytes,
-				RGBColor:        node.Color,
-				Alias:           alias,
-				Addresses:       node.Addresses,
-				ExtraOpaqueData: node.ExtraOpaqueData,
-			},
-		}
+		err := graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-		// Serialize to JSON
-		jsonBytes, err := json.Marshal(nodeAnn)
-		if err != nil {
-			return fmt.Errorf("failed to marshal node announcement to JSON: %w", err)
-		}
+			node := nodeTx.Node()
+			nodeID := hex.EncodeToString(node.PubKeyBytes[:])
+
+			// Nodes known only from channel announcements carry no feature vector
+			nodeFeatures := lnwire.NewRawFeatureVector()
+			if node.Features != nil {
+				nodeFeatures = node.Features.RawFeatureVector
+			}
 
-		values = append(values,
-			hex.EncodeToString(node.PubKeyBytes[:]),
-			alias.String(),
-			fmt.Sprintf("#%02x%02x%02x", node.Color.R, node.Color.G, node.Color.B),
-			string(jsonBytes),
-		)
-		placeholders = append(placeholders, "(?, ?, ?, ?, NOW(), NOW())")
+			current.addNode(node, nodeFeatures)
 
-		count++
+			if !filter.nodeChanged(nodeID, node.LastUpdate) {
+				filter.skipNode(nodeID)
+				return nil
+			}
 
-		// Process batch when limit reached
-		if count%batchSize == 0 {
-			if err := executeBatchNodeAnnouncements(tx, placeholders, values); err != nil {
+			// Create node alias
+			alias, err := lnwire.NewNodeAlias(node.Alias)
+			if err != nil {
+				return fmt.Errorf("failed to create node alias: %w", err)
+			}
+
+			// Create node announcement wrapper
+			nodeAnn := models.CustomNodeAnnouncement{
+				NodeAnnouncement: lnwire.NodeAnnouncement{
+					Features:        nodeFeatures,
+					Timestamp:       uint32(node.LastUpdate.Unix()),
+					NodeID:          node.PubKeyBytes,
+					RGBColor:        node.Color,
+					Alias:           alias,
+					Addresses:       node.Addresses,
+					ExtraOpaqueData: node.ExtraOpaqueData,
+				},
+			}
+
+			// Serialize to JSON
+			jsonBytes, err := json.Marshal(nodeAnn)
+			if err != nil {
+				return fmt.Errorf("failed to marshal node announcement to JSON: %w", err)
+			}
+
+			err = announcements.Add(
+				nodeID,
+				alias.String(),
+				fmt.Sprintf("#%02x%02x%02x", node.Color.R, node.Color.G, node.Color.B),
+				models.FeaturesHex(nodeFeatures),
+				string(jsonBytes),
+			)
+			if err != nil {
 				return err
 			}
-			values = nil
-			placeholders = nil
-		}
 
-		return nil
-	})
+			count++
 
-	if err != nil {
-		return fmt.Errorf("failed to iterate nodes: %w", err)
-	}
+			for _, feature := range models.DecodeFeatureFlags(nodeFeatures) {
+				err := features.Add(
+					nodeID,
+					feature.Bit,
+					feature.Name,
+					feature.Required,
+				)
+				if err != nil {
+					return err
+				}
 
-	// Process remaining records
-	if len(values) > 0 {
-		if err := executeBatchNodeAnnouncements(tx, placeholders, values); err != nil {
-			return err
+				featureCount++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to iterate nodes: %w", err)
 		}
+
+		// Process remaining records
+		return flushAll(announcements, features)
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Successfully imported %d node announcements", count)
+	log.Printf("Successfully imported %d node feature bits", featureCount)
 	return nil
 }
 
-// executeBatchNodeAnnouncements executes a batch insert for node announcements
-func executeBatchNodeAnnouncements(tx *sql.Tx, placeholders []string, values []interface{}) error {
-	query := `INSERT INTO node_announcements 
-		(node_id, alias, rgb_color, json_data, first_seen, last_seen) 
-		VALUES ` + strings.Join(placeholders, ",") + ` 
-		ON DUPLICATE KEY UPDATE 
-		alias = VALUES(alias),
-		rgb_color = VALUES(rgb_color),
-		json_data = VALUES(json_data),
-		last_seen = NOW()`
-
-	_, err := tx.Exec(query, values...)
-	if err != nil {
-		return fmt.Errorf("failed to execute batch insert: %w", err)
-	}
+// nodeAnnouncementsTable describes the upsert of node announcements
+var nodeAnnouncementsTable = &Table{
+	Name: "node_announcements",
+	Columns: []Column{
+		{"node_id", ColumnKey},
+		{"alias", ColumnValue},
+		{"rgb_color", ColumnValue},
+		{"features", ColumnValue},
+		{"json_data", ColumnValue},
+	},
+	Key:    []string{"node_id", "alias", "rgb_color"},
+	Update: []string{"alias", "rgb_color", "features", "json_data"},
+	Touch:  []string{"last_seen"},
+	Clear:  []string{"removed_at"},
+	Now:    []string{"first_seen", "last_seen"},
+}
 
-	return nil
+// nodeFeaturesTable describes the upsert of decoded node feature bits
+var nodeFeaturesTable = &Table{
+	Name: "node_features",
+	Columns: []Column{
+		{"node_id", ColumnKey},
+		{"bit", ColumnValue},
+		{"name", ColumnValue},
+		{"required", ColumnValue},
+	},
+	Key:    []string{"node_id", "bit"},
+	Update: []string{"name", "required"},
+	Touch:  []string{"last_seen"},
+	Clear:  []string{"removed_at"},
+	Now:    []string{"first_seen", "last_seen"},
 }
 
-// SendNodeAddresses imports all node addresses from the LND graph to MySQL
-func SendNodeAddresses(graph models.ChannelGraph, db *sql.DB) error {
-	log.Printf("Importing node addresses to MySQL")
+// SendNodeAddresses imports all node addresses from the LND graph.
+// The addresses of nodes the incremental filter considers unchanged are skipped.
+func SendNodeAddresses(ctx context.Context, graph models.ChannelGraph, session *Session, filter *IncrementalFilter, stats SyncStats) error {
+	log.Printf("Importing node addresses to %s", session.sink.Name())
 
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
-
-	var values []interface{}
-	var placeholders []string
 	count := 0
 
-	err = graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
-		node := nodeTx.Node()
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		addresses := newBatchWriter(ctx, session.sink, tx, nodeAddressesTable, stats)
 
-		for _, addr := range node.Addresses {
-			host, portStr, err := net.SplitHostPort(addr.String())
-			if err != nil {
-				// Handle addresses without port
-				host = addr.String()
-				portStr = "0"
+		err := graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
 
-			port, _ := strconv.ParseUint(portStr, 10, 32)
+			node := nodeTx.Node()
+			nodeID := hex.EncodeToString(node.PubKeyBytes[:])
 
-			values = append(values,
-				hex.EncodeToString(node.PubKeyBytes[:]),
-				host,
-				uint32(port),
-			)
-			placeholders = append(placeholders, "(?, ?, ?, NOW(), NOW())")
+			if !filter.nodeChanged(nodeID, node.LastUpdate) {
+				return nil
+			}
 
-			count++
+			for _, addr := range node.Addresses {
+				customAddr := models.NewCustomAddress(addr)
 
-			// Process batch when limit reached
-			if count%batchSize == 0 {
-				if err := executeBatchNodeAddresses(tx, placeholders, values); err != nil {
+				err := addresses.Add(
+					nodeID,
+					customAddr.Type,
+					customAddr.Address,
+					uint32(customAddr.Port),
+				)
+				if err != nil {
 					return err
 				}
-				values = nil
-				placeholders = nil
+
+				count++
 			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to iterate node addresses: %w", err)
 		}
 
-		return nil
+		// Process remaining records
+		return addresses.Flush()
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to iterate node addresses: %w", err)
-	}
-
-	// Process remaining records
-	if len(values) > 0 {
-		if err := executeBatchNodeAddresses(tx, placeholders, values); err != nil {
-			return err
-		}
+		return err
 	}
 
 	log.Printf("Successfully imported %d node addresses", count)
 	return nil
 }
 
-// executeBatchNodeAddresses executes a batch insert for node addresses
-func executeBatchNodeAddresses(tx *sql.Tx, placeholders []string, values []interface{}) error {
-	query := `INSERT INTO node_addresses 
-		(node_id, address, port, first_seen, last_seen) 
-		VALUES ` + strings.Join(placeholders, ",") + ` 
-		ON DUPLICATE KEY UPDATE 
-		address = VALUES(address),
-		port = VALUES(port),
-		last_seen = NOW()`
-
-	_, err := tx.Exec(query, values...)
-	if err != nil {
-		return fmt.Errorf("failed to execute batch insert: %w", err)
-	}
-
-	return nil
+// nodeAddressesTable describes the upsert of node addresses
+var nodeAddressesTable = &Table{
+	Name: "node_addresses",
+	Columns: []Column{
+		{"node_id", ColumnKey},
+		{"address_type", ColumnValue},
+		{"address", ColumnValue},
+		{"port", ColumnValue},
+	},
+	Key:    []string{"node_id", "address", "port"},
+	Update: []string{"address_type", "address", "port"},
+	Touch:  []string{"last_seen"},
+	Clear:  []string{"removed_at"},
+	Now:    []string{"first_seen", "last_seen"},
 }
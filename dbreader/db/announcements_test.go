@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"image/color"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"lnd-dbreader/models"
+)
+
+// fakeChannel is a channel of fakeGraph with its two policies
+type fakeChannel struct {
+	info   *models.ChannelEdgeInfo
+	c1, c2 *models.ChannelEdgePolicy
+}
+
+// fakeGraph is an in-memory models.ChannelGraph
+type fakeGraph struct {
+	channels []fakeChannel
+	nodes    []*models.LightningNode
+}
+
+func (g *fakeGraph) ForEachChannel(cb func(*models.ChannelEdgeInfo, *models.ChannelEdgePolicy, *models.ChannelEdgePolicy) error) error {
+	for _, channel := range g.channels {
+		if err := cb(channel.info, channel.c1, channel.c2); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *fakeGraph) ForEachNode(cb func(graphdb.NodeRTx) error) error {
+	for _, node := range g.nodes {
+		if err := cb(&fakeNodeTx{graph: g, node: node}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fakeNodeTx is the graphdb.NodeRTx of a fakeGraph node
+type fakeNodeTx struct {
+	graph *fakeGraph
+	node  *models.LightningNode
+}
+
+func (n *fakeNodeTx) Node() *models.LightningNode {
+	return n.node
+}
+
+func (n *fakeNodeTx) ForEachChannel(cb func(*models.ChannelEdgeInfo, *models.ChannelEdgePolicy, *models.ChannelEdgePolicy) error) error {
+	for _, channel := range n.graph.channels {
+		if channel.info.NodeKey1Bytes == n.node.PubKeyBytes || channel.info.NodeKey2Bytes == n.node.PubKeyBytes {
+			if err := cb(channel.info, channel.c1, channel.c2); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *fakeNodeTx) FetchNode(vertex route.Vertex) (graphdb.NodeRTx, error) {
+	for _, node := range n.graph.nodes {
+		if node.PubKeyBytes == vertex {
+			return &fakeNodeTx{graph: n.graph, node: node}, nil
+		}
+	}
+
+	return nil, graphdb.ErrGraphNodeNotFound
+}
+
+// testVertex returns a node key filled with b
+func testVertex(b byte) [33]byte {
+	var key [33]byte
+	key[0] = 0x02
+	for i := 1; i < len(key); i++ {
+		key[i] = b
+	}
+
+	return key
+}
+
+// testKey returns the hex encoding of testVertex
+func testKey(b byte) string {
+	key := testVertex(b)
+	return hex.EncodeToString(key[:])
+}
+
+// testChannel returns an unannounced channel between two nodes with both policies
+func testChannel(scid uint64, node1, node2 byte, feeBase lnwire.MilliSatoshi) fakeChannel {
+	info := &models.ChannelEdgeInfo{
+		ChannelID:        scid,
+		NodeKey1Bytes:    testVertex(node1),
+		NodeKey2Bytes:    testVertex(node2),
+		BitcoinKey1Bytes: testVertex(node1 + 100),
+		BitcoinKey2Bytes: testVertex(node2 + 100),
+		Features:         []byte{},
+		Capacity:         1000000,
+	}
+
+	policy := func(direction lnwire.ChanUpdateChanFlags) *models.ChannelEdgePolicy {
+		return &models.ChannelEdgePolicy{
+			ChannelID:                 scid,
+			LastUpdate:                time.Unix(1700000000, 0),
+			MessageFlags:              lnwire.ChanUpdateRequiredMaxHtlc,
+			ChannelFlags:              direction,
+			TimeLockDelta:             80,
+			MinHTLC:                   1000,
+			MaxHTLC:                   990000000,
+			FeeBaseMSat:               feeBase,
+			FeeProportionalMillionths: 100,
+		}
+	}
+
+	return fakeChannel{info: info, c1: policy(0), c2: policy(lnwire.ChanUpdateDirection)}
+}
+
+// testNode returns a node with an IPv4 address and one feature bit
+func testNode(b byte, alias string) *models.LightningNode {
+	return &models.LightningNode{
+		PubKeyBytes:          testVertex(b),
+		HaveNodeAnnouncement: true,
+		LastUpdate:           time.Unix(1700000000, 0),
+		Addresses:            []net.Addr{&net.TCPAddr{IP: net.IPv4(192, 0, 2, b), Port: 9735}},
+		Color:                color.RGBA{R: 0x33, G: 0x99, B: 0xff},
+		Alias:                alias,
+		Features:             lnwire.NewFeatureVector(lnwire.NewRawFeatureVector(lnwire.TLVOnionPayloadRequired), lnwire.Features),
+	}
+}
+
+func TestSendChannelAnnouncements(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	stats := SyncStats{}
+
+	graph := &fakeGraph{channels: []fakeChannel{
+		testChannel(1, 2, 3, 1000),
+		testChannel(2, 3, 4, 1000),
+		// LND never yields a channel twice, but the batch writer must still
+		// write it once
+		testChannel(1, 2, 3, 1000),
+	}}
+
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, stats); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "channel_announcements", ""); got != 2 {
+		t.Errorf("got %d channel announcements, want 2", got)
+	}
+	if got := countRows(t, sink, "channel_announcements", "short_channel_id = 2 AND node_id_1 = ? AND node_id_2 = ?",
+		testKey(3), testKey(4)); got != 1 {
+		t.Errorf("channel 2 was not written with its node keys")
+	}
+	if got := countRows(t, sink, "channel_policies", ""); got != 4 {
+		t.Errorf("got %d channel policies, want 4", got)
+	}
+	if got := countRows(t, sink, "channel_policies", "short_channel_id = 1 AND direction = 1 AND node_id = ?",
+		testKey(3)); got != 1 {
+		t.Errorf("the second policy of channel 1 is not attributed to node 2")
+	}
+	if got := countRows(t, sink, "channel_policy_updates", ""); got != 4 {
+		t.Errorf("got %d policy versions, want 4", got)
+	}
+	if got := stats.Table("channel_announcements").Read; got != 3 {
+		t.Errorf("got %d channel announcements read, want 3", got)
+	}
+
+	// A new fee updates the policy and appends a version to the history
+	graph.channels = []fakeChannel{testChannel(1, 2, 3, 2000)}
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, SyncStats{}); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "channel_policies", "short_channel_id = 1 AND fee_base_msat = 2000"); got != 2 {
+		t.Errorf("got %d channel 1 policies with the new fee, want 2", got)
+	}
+	if got := countRows(t, sink, "channel_policy_updates", ""); got != 6 {
+		t.Errorf("got %d policy versions, want 6", got)
+	}
+}
+
+func TestSendChannelAnnouncementsStoresAliasSCIDs(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	// Alias SCIDs start at block 16,000,000 and have the high bit set
+	alias := uint64(16_000_000 << 40)
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(alias, 2, 3, 1000)}}
+
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	if got := countRows(t, sink, "channel_policies", "short_channel_id = ?", int64(alias)); got != 2 {
+		t.Errorf("got %d policies of the alias SCID, want 2", got)
+	}
+
+	state, err := LoadPreviousGraphState(ctx, NewSession(sink))
+	if err != nil {
+		t.Fatalf("LoadPreviousGraphState failed: %v", err)
+	}
+	if channel, ok := state.Channels[alias]; !ok || channel.Policies[1] == nil {
+		t.Errorf("the alias SCID did not read back as %d", alias)
+	}
+}
+
+func TestSendChannelAnnouncementsRollsBack(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	// The history insert is flushed last, after the announcements and policies
+	if _, err := sink.DB().Exec("DROP TABLE channel_policy_updates"); err != nil {
+		t.Fatalf("failed to drop channel_policy_updates: %v", err)
+	}
+
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(1, 2, 3, 1000)}}
+	err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "channel_policy_updates") {
+		t.Fatalf("got error %v, want the failed history insert", err)
+	}
+
+	for _, table := range []string{"channel_announcements", "channel_policies"} {
+		if got := countRows(t, sink, table, ""); got != 0 {
+			t.Errorf("got %d rows in %s after rollback, want 0", got, table)
+		}
+	}
+}
+
+func TestSendChannelAnnouncementsKeepsUnparsableProof(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	// A truncated DER signature cannot be converted to the wire format
+	broken := testChannel(1, 2, 3, 1000)
+	broken.info.AuthProof = &models.ChannelAuthProof{
+		NodeSig1Bytes:    []byte{0x30, 0x06},
+		NodeSig2Bytes:    []byte{0x30, 0x06},
+		BitcoinSig1Bytes: []byte{0x30, 0x06},
+		BitcoinSig2Bytes: []byte{0x30, 0x06},
+	}
+	graph := &fakeGraph{channels: []fakeChannel{broken, testChannel(2, 3, 4, 1000)}}
+
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "channel_announcements", ""); got != 2 {
+		t.Errorf("got %d channel announcements, want 2", got)
+	}
+	if got := countRows(t, sink, "channel_announcements", "short_channel_id = 1 AND node_signature_1 = '' AND verification_status = ?",
+		VerificationInvalid); got != 1 {
+		t.Errorf("channel 1 was not stored without signatures as invalid")
+	}
+	if got := countRows(t, sink, "channel_announcements", "short_channel_id = 2 AND verification_status IS NULL"); got != 1 {
+		t.Errorf("channel 2 got a verification status without verification")
+	}
+}
+
+func TestSendNodeAnnouncements(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	// Nodes known only from channel announcements have no features
+	bare := &models.LightningNode{PubKeyBytes: testVertex(4)}
+	graph := &fakeGraph{nodes: []*models.LightningNode{testNode(2, "alice"), testNode(3, "bob"), bare}}
+
+	if err := SendNodeAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "node_announcements", ""); got != 3 {
+		t.Errorf("got %d node announcements, want 3", got)
+	}
+	if got := countRows(t, sink, "node_announcements", "node_id = ? AND alias = 'alice' AND rgb_color = '#3399ff'",
+		testKey(2)); got != 1 {
+		t.Errorf("node 2 was not written with its alias and color")
+	}
+	if got := countRows(t, sink, "node_features", ""); got != 2 {
+		t.Errorf("got %d node feature bits, want 2", got)
+	}
+	if got := countRows(t, sink, "node_features", "node_id = ? AND bit = ?", testKey(2), int(lnwire.TLVOnionPayloadRequired)); got != 1 {
+		t.Errorf("the feature bit of node 2 is missing")
+	}
+}
+
+func TestSendNodeAddresses(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	alice := testNode(2, "alice")
+	alice.Addresses = append(alice.Addresses, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 9735})
+	graph := &fakeGraph{nodes: []*models.LightningNode{alice, testNode(3, "bob")}}
+
+	if err := SendNodeAddresses(ctx, graph, NewSession(sink), nil, nil); err != nil {
+		t.Fatalf("SendNodeAddresses failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "node_addresses", ""); got != 3 {
+		t.Errorf("got %d node addresses, want 3", got)
+	}
+	if got := countRows(t, sink, "node_addresses", "node_id = ? AND address = '192.0.2.3' AND port = 9735",
+		testKey(3)); got != 1 {
+		t.Errorf("the address of node 3 is missing")
+	}
+}
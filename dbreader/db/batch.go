@@ -0,0 +1,146 @@
+/*
+Package db provides the transactional batch writer shared by the importers.
+
+Every importer queues rows per table in a batchWriter, which writes them as
+multi-row statements of at most batchSize rows. The importers run inside
+Session.withTx, which rolls back on any error and reports failed commits
+instead of logging a successful import.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// batchSize defines the number of records to process in a single database statement
+const batchSize = 5000
+
+// batchWriter accumulates rows for a single table and writes them as multi-row statements
+type batchWriter struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	sink    Sink
+	table   *Table
+	stats   *TableStats
+	maxRows int
+
+	// keyColumns holds the positions of the key columns within a row
+	keyColumns []int
+
+	values []interface{}
+	rows   int
+
+	// queued maps the key of every queued row to its row number
+	queued map[string]int
+}
+
+// newBatchWriter creates a writer that upserts the queued rows into table and
+// counts them in the table's stats
+func newBatchWriter(ctx context.Context, sink Sink, tx *sql.Tx, table *Table, stats SyncStats) *batchWriter {
+	maxRows := batchSize
+	if limit := sink.MaxArgs() / len(table.Columns); limit < maxRows {
+		maxRows = limit
+	}
+
+	var keyColumns []int
+	for _, key := range table.Key {
+		for i, column := range table.Columns {
+			if column.Name == key {
+				keyColumns = append(keyColumns, i)
+			}
+		}
+	}
+
+	return &batchWriter{
+		ctx:        ctx,
+		tx:         tx,
+		sink:       sink,
+		table:      table,
+		stats:      stats.Table(table.Name),
+		maxRows:    maxRows,
+		keyColumns: keyColumns,
+		queued:     make(map[string]int),
+	}
+}
+
+// Add queues one row, given in the order of the table's columns, and writes the
+// batch once it is full. A row whose key is already queued replaces the queued
+// row, or is dropped for tables that leave existing rows untouched, because
+// PostgreSQL refuses to upsert the same row twice in one statement.
+func (w *batchWriter) Add(values ...interface{}) error {
+	if len(values) != len(w.table.Columns) {
+		return fmt.Errorf("got %d values for the %d columns of %s", len(values), len(w.table.Columns), w.table.Name)
+	}
+	w.stats.countRead()
+
+	row := make([]interface{}, len(values))
+	for i, column := range w.table.Columns {
+		value, err := columnArg(w.sink, column.Kind, values[i])
+		if err != nil {
+			return err
+		}
+		row[i] = value
+	}
+
+	if len(w.keyColumns) > 0 {
+		key := w.rowKey(row)
+		if queued, ok := w.queued[key]; ok {
+			if !w.table.ignoresDuplicates() {
+				copy(w.values[queued*len(row):], row)
+			}
+			return nil
+		}
+		w.queued[key] = w.rows
+	}
+
+	w.values = append(w.values, row...)
+	w.rows++
+
+	if w.rows >= w.maxRows {
+		return w.Flush()
+	}
+
+	return nil
+}
+
+// rowKey renders the key columns of a row as a map key
+func (w *batchWriter) rowKey(values []interface{}) string {
+	parts := make([]string, len(w.keyColumns))
+	for i, column := range w.keyColumns {
+		parts[i] = fmt.Sprintf("%v", values[column])
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// Flush writes all queued rows. It is a no-op when nothing is queued.
+func (w *batchWriter) Flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+
+	inserted, updated, err := w.sink.ExecUpsert(w.ctx, w.tx, w.table, w.rows, w.values)
+	if err != nil {
+		return fmt.Errorf("failed to execute batch insert into %s: %w", w.table.Name, err)
+	}
+	w.stats.addCounts(inserted, updated)
+
+	w.values = nil
+	w.rows = 0
+	w.queued = make(map[string]int)
+	return nil
+}
+
+// flushAll flushes the writers in order and stops at the first error
+func flushAll(writers ...*batchWriter) error {
+	for _, writer := range writers {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
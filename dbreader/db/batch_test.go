@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestSink creates the tables in a fresh SQLite file and returns its sink
+func openTestSink(t *testing.T) Sink {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "graph.sqlite")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("failed to open SQLite file: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	sink, err := NewSink(BackendSQLite, conn)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := InitializeDatabaseTables(context.Background(), sink); err != nil {
+		t.Fatalf("failed to initialize tables: %v", err)
+	}
+
+	return sink
+}
+
+// countRows returns the number of rows of table matching the optional condition
+func countRows(t *testing.T, sink Sink, table, condition string, args ...interface{}) int {
+	t.Helper()
+
+	query := "SELECT COUNT(*) FROM " + table
+	if condition != "" {
+		query += " WHERE " + condition
+	}
+
+	var count int
+	if err := sink.DB().QueryRow(sink.Rebind(query), args...).Scan(&count); err != nil {
+		t.Fatalf("failed to count rows of %s: %v", table, err)
+	}
+
+	return count
+}
+
+// recordingSink records the number of rows of every statement ExecUpsert runs
+type recordingSink struct {
+	Sink
+	batches []int
+}
+
+func (s *recordingSink) ExecUpsert(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (int64, int64, error) {
+	s.batches = append(s.batches, rows)
+	return s.Sink.ExecUpsert(ctx, q, table, rows, args)
+}
+
+// zombieRow returns the values of a zombie_channels row
+func zombieRow(scid uint64, node1, node2 byte) []interface{} {
+	return []interface{}{scid, testKey(node1), testKey(node2)}
+}
+
+func TestBatchWriterFlushesPartialBatch(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	stats := SyncStats{}
+
+	err := NewSession(sink).withTx(ctx, func(tx *sql.Tx) error {
+		zombies := newBatchWriter(ctx, sink, tx, zombieChannelsTable, stats)
+		for scid := uint64(1); scid <= 3; scid++ {
+			if err := zombies.Add(zombieRow(scid, 2, 3)...); err != nil {
+				return err
+			}
+		}
+
+		// Three rows never fill a batch, only Flush writes them
+		var queued int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM zombie_channels").Scan(&queued); err != nil {
+			return err
+		}
+		if queued != 0 {
+			t.Errorf("got %d rows before Flush, want 0", queued)
+		}
+
+		return zombies.Flush()
+	})
+	if err != nil {
+		t.Fatalf("withTx failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "zombie_channels", ""); got != 3 {
+		t.Errorf("got %d zombie channels, want 3", got)
+	}
+	if got := stats.Table("zombie_channels").Read; got != 3 {
+		t.Errorf("got %d rows read, want 3", got)
+	}
+}
+
+func TestBatchWriterDeduplicatesKeys(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	recorder := &recordingSink{Sink: sink}
+
+	err := NewSession(recorder).withTx(ctx, func(tx *sql.Tx) error {
+		// Updating tables keep the last queued row of a key
+		zombies := newBatchWriter(ctx, recorder, tx, zombieChannelsTable, nil)
+		for _, row := range [][]interface{}{zombieRow(1, 2, 3), zombieRow(2, 2, 3), zombieRow(1, 4, 5)} {
+			if err := zombies.Add(row...); err != nil {
+				return err
+			}
+		}
+
+		// Tables that leave existing rows untouched keep the first one
+		history := newBatchWriter(ctx, recorder, tx, channelPolicyUpdatesTable, nil)
+		for _, fee := range []uint64{1000, 1000, 2000} {
+			if err := history.Add(uint64(7), 0, testKey(2), fee, uint64(1), 40, uint64(1000), uint64(990000000),
+				uint8(1), uint8(0), false, int64(1700000000)); err != nil {
+				return err
+			}
+		}
+
+		return flushAll(zombies, history)
+	})
+	if err != nil {
+		t.Fatalf("withTx failed: %v", err)
+	}
+
+	if len(recorder.batches) != 2 || recorder.batches[0] != 2 || recorder.batches[1] != 2 {
+		t.Errorf("got statements of %v rows, want [2 2]", recorder.batches)
+	}
+	if got := countRows(t, sink, "zombie_channels", ""); got != 2 {
+		t.Errorf("got %d zombie channels, want 2", got)
+	}
+	if got := countRows(t, sink, "zombie_channels", "short_channel_id = 1 AND node_id_1 = ?", testKey(4)); got != 1 {
+		t.Errorf("zombie channel 1 does not carry the last queued node keys")
+	}
+	if got := countRows(t, sink, "channel_policy_updates", ""); got != 2 {
+		t.Errorf("got %d policy versions, want 2", got)
+	}
+}
+
+func TestBatchWriterCountsInsertsAndUpdates(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	stats := SyncStats{}
+
+	for _, rows := range [][][]interface{}{
+		{zombieRow(1, 2, 3), zombieRow(2, 2, 3)},
+		{zombieRow(2, 4, 5), zombieRow(3, 2, 3)},
+	} {
+		err := NewSession(sink).withTx(ctx, func(tx *sql.Tx) error {
+			zombies := newBatchWriter(ctx, sink, tx, zombieChannelsTable, stats)
+			history := newBatchWriter(ctx, sink, tx, channelPolicyUpdatesTable, stats)
+			for _, row := range rows {
+				if err := zombies.Add(row...); err != nil {
+					return err
+				}
+				if err := history.Add(row[0], 0, testKey(2), uint64(1000), uint64(1), 40, uint64(1000), uint64(990000000),
+					uint8(1), uint8(0), false, int64(1700000000)); err != nil {
+					return err
+				}
+			}
+
+			return flushAll(zombies, history)
+		})
+		if err != nil {
+			t.Fatalf("withTx failed: %v", err)
+		}
+	}
+
+	if got := *stats.Table("zombie_channels"); got.Inserted != 3 || got.Updated != 1 {
+		t.Errorf("got %d inserted and %d updated zombie channels, want 3 and 1", got.Inserted, got.Updated)
+	}
+	if got := *stats.Table("channel_policy_updates"); got.Inserted != 3 || got.Updated != 0 {
+		t.Errorf("got %d inserted and %d updated policy versions, want 3 and 0", got.Inserted, got.Updated)
+	}
+}
+
+func TestBatchWriterSplitsAtMaxArgs(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	recorder := &recordingSink{Sink: sink}
+
+	// channel_announcements has enough columns for MaxArgs to cap a batch
+	// below batchSize, so this fills one statement to the limit and starts another
+	maxRows := sink.MaxArgs() / len(channelAnnouncementsTable.Columns)
+	if maxRows >= batchSize {
+		t.Fatalf("MaxArgs allows %d rows, the test needs fewer than batchSize", maxRows)
+	}
+
+	err := NewSession(recorder).withTx(ctx, func(tx *sql.Tx) error {
+		announcements := newBatchWriter(ctx, recorder, tx, channelAnnouncementsTable, nil)
+		for scid := uint64(1); scid <= uint64(maxRows+1); scid++ {
+			if err := announcements.Add(scid, testKey(2), testKey(3), testKey(4), testKey(5), int64(100000),
+				"00", uint32(0), "", "", "", "", "", "", "{}"); err != nil {
+				return err
+			}
+		}
+
+		return announcements.Flush()
+	})
+	if err != nil {
+		t.Fatalf("withTx failed: %v", err)
+	}
+
+	if len(recorder.batches) != 2 || recorder.batches[0] != maxRows || recorder.batches[1] != 1 {
+		t.Errorf("got statements of %v rows, want [%d 1]", recorder.batches, maxRows)
+	}
+	if got := countRows(t, sink, "channel_announcements", ""); got != maxRows+1 {
+		t.Errorf("got %d channel announcements, want %d", got, maxRows+1)
+	}
+}
+
+func TestWithTxRollsBackFailedStatement(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	err := NewSession(sink).withTx(ctx, func(tx *sql.Tx) error {
+		zombies := newBatchWriter(ctx, sink, tx, zombieChannelsTable, nil)
+		if err := zombies.Add(zombieRow(1, 2, 3)...); err != nil {
+			return err
+		}
+		if err := zombies.Flush(); err != nil {
+			return err
+		}
+
+		// short_channel_id is NOT NULL
+		if err := zombies.Add(nil, testKey(2), testKey(3)); err != nil {
+			return err
+		}
+		return zombies.Flush()
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to execute batch insert into zombie_channels") {
+		t.Fatalf("got error %v, want the failed batch insert", err)
+	}
+
+	if got := countRows(t, sink, "zombie_channels", ""); got != 0 {
+		t.Errorf("got %d zombie channels after rollback, want 0", got)
+	}
+}
+
+func TestWithTxReturnsCommitError(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	// A deferred foreign key is only checked, and fails, on commit
+	_, err := sink.DB().Exec(`CREATE TABLE parents (id INTEGER PRIMARY KEY);
+		CREATE TABLE children (parent_id INTEGER REFERENCES parents (id) DEFERRABLE INITIALLY DEFERRED)`)
+	if err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+
+	err = NewSession(sink).withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO children (parent_id) VALUES (1)")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to commit transaction") {
+		t.Fatalf("got error %v, want the failed commit", err)
+	}
+}
+
+func TestAtomicSessionSharesTransaction(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	session, err := BeginAtomicSession(ctx, sink)
+	if err != nil {
+		t.Fatalf("failed to begin atomic session: %v", err)
+	}
+
+	err = session.withTx(ctx, func(tx *sql.Tx) error {
+		zombies := newBatchWriter(ctx, sink, tx, zombieChannelsTable, nil)
+		if err := zombies.Add(zombieRow(1, 2, 3)...); err != nil {
+			return err
+		}
+		return zombies.Flush()
+	})
+	if err != nil {
+		t.Fatalf("withTx failed: %v", err)
+	}
+
+	// A failing importer leaves the shared transaction to the session owner
+	importErr := errors.New("import failed")
+	err = session.withTx(ctx, func(tx *sql.Tx) error { return importErr })
+	if !errors.Is(err, importErr) {
+		t.Fatalf("got error %v, want %v", err, importErr)
+	}
+
+	if err := session.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if got := countRows(t, sink, "zombie_channels", ""); got != 0 {
+		t.Errorf("got %d zombie channels after rolling back the session, want 0", got)
+	}
+}
@@ -0,0 +1,493 @@
+/*
+Package db provides the diff engine that turns consecutive syncs into graph events.
+
+The graph this sync's importers collect while they iterate over it is compared
+with the state the previous sync left in the database, and every difference is stored as a typed row in graph_events:
+channels opened and closed, policy changes, alias changes, addresses added
+and removed, and feature changes.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+	"lnd-dbreader/models"
+)
+
+// Event types stored in graph_events.event_type
+const (
+	EventChannelOpened    = "channel_opened"
+	EventChannelClosed    = "channel_closed"
+	EventPolicyChanged    = "policy_changed"
+	EventNodeAliasChanged = "node_alias_changed"
+	EventAddressAdded     = "address_added"
+	EventAddressRemoved   = "address_removed"
+	EventFeatureChanged   = "feature_changed"
+)
+
+// PolicyState holds the routing policy fields compared between syncs
+type PolicyState struct {
+	FeeBaseMSat      uint64 `json:"fee_base_msat"`
+	FeeRateMilliMSat uint64 `json:"fee_rate_milli_msat"`
+	TimeLockDelta    uint16 `json:"time_lock_delta"`
+	MinHTLCMSat      uint64 `json:"min_htlc_msat"`
+	MaxHTLCMSat      uint64 `json:"max_htlc_msat"`
+	Disabled         bool   `json:"disabled"`
+}
+
+// ChannelState holds the per-channel data compared between syncs
+type ChannelState struct {
+	NodeID1  string
+	NodeID2  string
+	Policies [2]*PolicyState
+
+	// PolicyUnknown marks directions whose stored policy has NULL fields,
+	// written before those columns existed. They are not compared.
+	PolicyUnknown [2]bool
+}
+
+// NodeState holds the per-node data compared between syncs
+type NodeState struct {
+	Alias string
+
+	// Features is nil for rows written before the features column existed
+	Features  *string
+	Addresses map[string]models.CustomAddress
+}
+
+// GraphState is the subset of the graph the diff engine compares
+type GraphState struct {
+	Channels map[uint64]*ChannelState
+	Nodes    map[string]*NodeState
+}
+
+// GraphEvent is a single typed change between two syncs
+type GraphEvent struct {
+	Type           string
+	ShortChannelID *uint64
+	NodeID         *string
+	Direction      *int
+	OldValue       interface{}
+	NewValue       interface{}
+}
+
+// NewGraphState creates an empty graph state. Passed to SendChannelAnnouncements
+// and SendNodeAnnouncements, it collects the graph of this sync.
+func NewGraphState() *GraphState {
+	return &GraphState{
+		Channels: make(map[uint64]*ChannelState),
+		Nodes:    make(map[string]*NodeState),
+	}
+}
+
+// addressKey identifies an address within a node's address set. The type is left
+// out because rows imported by older versions have no address_type.
+func addressKey(addr models.CustomAddress) string {
+	return fmt.Sprintf("%s|%d", addr.Address, addr.Port)
+}
+
+// addChannel records a channel and its policies as the importer reads them.
+// A nil state collects nothing.
+func (s *GraphState) addChannel(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) {
+	if s == nil {
+		return
+	}
+
+	channel := &ChannelState{
+		NodeID1: hex.EncodeToString(edgeInfo.NodeKey1Bytes[:]),
+		NodeID2: hex.EncodeToString(edgeInfo.NodeKey2Bytes[:]),
+	}
+
+	for direction, policy := range []*models.ChannelEdgePolicy{c1, c2} {
+		if policy == nil {
+			continue
+		}
+		channel.Policies[direction] = &PolicyState{
+			FeeBaseMSat:      uint64(policy.FeeBaseMSat),
+			FeeRateMilliMSat: uint64(policy.FeeProportionalMillionths),
+			TimeLockDelta:    policy.TimeLockDelta,
+			MinHTLCMSat:      uint64(policy.MinHTLC),
+			MaxHTLCMSat:      uint64(policy.MaxHTLC),
+			Disabled:         policy.IsDisabled(),
+		}
+	}
+
+	s.Channels[edgeInfo.ChannelID] = channel
+}
+
+// addNode records a node with its features and addresses as the importer
+// reads it. A nil state collects nothing.
+func (s *GraphState) addNode(node *models.LightningNode, features *lnwire.RawFeatureVector) {
+	if s == nil {
+		return
+	}
+
+	featuresHex := models.FeaturesHex(features)
+	nodeState := &NodeState{
+		Alias:     node.Alias,
+		Features:  &featuresHex,
+		Addresses: make(map[string]models.CustomAddress),
+	}
+	for _, addr := range node.Addresses {
+		customAddr := models.NewCustomAddress(addr)
+		nodeState.Addresses[addressKey(customAddr)] = customAddr
+	}
+
+	s.Nodes[hex.EncodeToString(node.PubKeyBytes[:])] = nodeState
+}
+
+// LoadPreviousGraphState reads the state the previous sync left in the database.
+// It must run before this sync's importers touch the live tables.
+func LoadPreviousGraphState(ctx context.Context, session *Session) (*GraphState, error) {
+	state := NewGraphState()
+	sink := session.sink
+
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT short_channel_id, %s, %s
+			FROM channel_announcements WHERE removed_at IS NULL AND short_channel_id IS NOT NULL`,
+			sink.KeyText("node_id_1"), sink.KeyText("node_id_2")))
+		if err != nil {
+			return fmt.Errorf("failed to load channels: %w", err)
+		}
+		for rows.Next() {
+			var scid scanSCID
+			var nodeID1, nodeID2 sql.NullString
+			if err := rows.Scan(&scid, &nodeID1, &nodeID2); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan channel: %w", err)
+			}
+			state.Channels[uint64(scid)] = &ChannelState{NodeID1: nodeID1.String, NodeID2: nodeID2.String}
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, `SELECT short_channel_id, direction, fee_base_msat, fee_rate_milli_msat,
+			time_lock_delta, min_htlc_msat, max_htlc_msat, disabled
+			FROM channel_policies WHERE removed_at IS NULL`)
+		if err != nil {
+			return fmt.Errorf("failed to load policies: %w", err)
+		}
+		for rows.Next() {
+			var scid scanSCID
+			var direction int
+			var feeBase, feeRate, minHTLC, maxHTLC scanUint64
+			var timeLockDelta sql.NullInt64
+			var disabled sql.NullBool
+			err := rows.Scan(&scid, &direction, &feeBase, &feeRate, &timeLockDelta, &minHTLC, &maxHTLC, &disabled)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan policy: %w", err)
+			}
+
+			channel, ok := state.Channels[uint64(scid)]
+			if !ok || direction < 0 || direction > 1 {
+				continue
+			}
+			if !feeBase.Valid || !feeRate.Valid || !timeLockDelta.Valid || !minHTLC.Valid || !maxHTLC.Valid || !disabled.Valid {
+				channel.PolicyUnknown[direction] = true
+				continue
+			}
+			channel.Policies[direction] = &PolicyState{
+				FeeBaseMSat:      feeBase.Uint64,
+				FeeRateMilliMSat: feeRate.Uint64,
+				TimeLockDelta:    uint16(timeLockDelta.Int64),
+				MinHTLCMSat:      minHTLC.Uint64,
+				MaxHTLCMSat:      maxHTLC.Uint64,
+				Disabled:         disabled.Bool,
+			}
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		// Older alias variants are marked removed, so the latest row per node wins
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT %s, alias, features
+			FROM node_announcements WHERE removed_at IS NULL AND node_id IS NOT NULL
+			ORDER BY last_seen`, sink.KeyText("node_id")))
+		if err != nil {
+			return fmt.Errorf("failed to load nodes: %w", err)
+		}
+		for rows.Next() {
+			var nodeID string
+			var alias, features sql.NullString
+			if err := rows.Scan(&nodeID, &alias, &features); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan node: %w", err)
+			}
+			nodeState := &NodeState{
+				Alias:     alias.String,
+				Addresses: make(map[string]models.CustomAddress),
+			}
+			if features.Valid {
+				nodeState.Features = &features.String
+			}
+			state.Nodes[nodeID] = nodeState
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT %s, address_type, address, port
+			FROM node_addresses WHERE removed_at IS NULL`, sink.KeyText("node_id")))
+		if err != nil {
+			return fmt.Errorf("failed to load addresses: %w", err)
+		}
+		for rows.Next() {
+			var nodeID string
+			var addrType sql.NullString
+			var addr models.CustomAddress
+			if err := rows.Scan(&nodeID, &addrType, &addr.Address, &addr.Port); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan address: %w", err)
+			}
+			addr.Type = addrType.String
+			if node, ok := state.Nodes[nodeID]; ok {
+				node.Addresses[addressKey(addr)] = addr
+			}
+		}
+		return closeRows(rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// closeRows closes a result set and reports iteration errors
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return rows.Close()
+}
+
+// DiffGraphStates lists the changes from prev to cur in a stable order
+func DiffGraphStates(prev, cur *GraphState) []GraphEvent {
+	var events []GraphEvent
+
+	for _, scid := range sortedChannelIDs(cur.Channels) {
+		channel := cur.Channels[scid]
+
+		prevChannel, existed := prev.Channels[scid]
+		if !existed {
+			events = append(events, GraphEvent{
+				Type:           EventChannelOpened,
+				ShortChannelID: &scid,
+				NewValue:       map[string]string{"node_id_1": channel.NodeID1, "node_id_2": channel.NodeID2},
+			})
+			continue
+		}
+
+		for direction := 0; direction < 2; direction++ {
+			if prevChannel.PolicyUnknown[direction] {
+				continue
+			}
+
+			// A policy that disappeared is recorded with a NULL new value
+			oldPolicy, newPolicy := prevChannel.Policies[direction], channel.Policies[direction]
+			if oldPolicy == nil && newPolicy == nil || oldPolicy != nil && newPolicy != nil && *oldPolicy == *newPolicy {
+				continue
+			}
+
+			nodeID := channel.NodeID1
+			if direction == 1 {
+				nodeID = channel.NodeID2
+			}
+			events = append(events, GraphEvent{
+				Type:           EventPolicyChanged,
+				ShortChannelID: &scid,
+				NodeID:         &nodeID,
+				Direction:      &direction,
+				OldValue:       policyValue(oldPolicy),
+				NewValue:       policyValue(newPolicy),
+			})
+		}
+	}
+
+	for _, scid := range sortedChannelIDs(prev.Channels) {
+		if _, exists := cur.Channels[scid]; exists {
+			continue
+		}
+
+		channel := prev.Channels[scid]
+		events = append(events, GraphEvent{
+			Type:           EventChannelClosed,
+			ShortChannelID: &scid,
+			OldValue:       map[string]string{"node_id_1": channel.NodeID1, "node_id_2": channel.NodeID2},
+		})
+	}
+
+	for _, nodeID := range sortedKeys(cur.Nodes) {
+		node := cur.Nodes[nodeID]
+
+		// New nodes have no previous state to compare against
+		prevNode, existed := prev.Nodes[nodeID]
+		if !existed {
+			continue
+		}
+
+		if prevNode.Alias != node.Alias {
+			events = append(events, GraphEvent{
+				Type:     EventNodeAliasChanged,
+				NodeID:   &nodeID,
+				OldValue: prevNode.Alias,
+				NewValue: node.Alias,
+			})
+		}
+
+		// Features stored as NULL by older versions cannot be compared
+		if prevNode.Features != nil && node.Features != nil && *prevNode.Features != *node.Features {
+			events = append(events, GraphEvent{
+				Type:     EventFeatureChanged,
+				NodeID:   &nodeID,
+				OldValue: *prevNode.Features,
+				NewValue: *node.Features,
+			})
+		}
+
+		for _, key := range sortedKeys(node.Addresses) {
+			if _, existed := prevNode.Addresses[key]; !existed {
+				events = append(events, GraphEvent{
+					Type:     EventAddressAdded,
+					NodeID:   &nodeID,
+					NewValue: node.Addresses[key],
+				})
+			}
+		}
+
+		for _, key := range sortedKeys(prevNode.Addresses) {
+			if _, exists := node.Addresses[key]; !exists {
+				events = append(events, GraphEvent{
+					Type:     EventAddressRemoved,
+					NodeID:   &nodeID,
+					OldValue: prevNode.Addresses[key],
+				})
+			}
+		}
+	}
+
+	return events
+}
+
+// policyValue returns the event value of a policy, nil if there is none
+func policyValue(policy *PolicyState) interface{} {
+	if policy == nil {
+		return nil
+	}
+
+	return policy
+}
+
+// sortedChannelIDs returns the channel IDs of a state in ascending order
+func sortedChannelIDs(channels map[uint64]*ChannelState) []uint64 {
+	ids := make([]uint64, 0, len(channels))
+	for id := range channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// sortedKeys returns the keys of a string-keyed map in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RecordGraphEvents diffs the graph collected by this sync's importers against
+// the previous state and stores the events.
+// Without a previous state, as on the first sync, everything would show up as new,
+// so no events are recorded and this sync becomes the baseline.
+func RecordGraphEvents(ctx context.Context, current, previous *GraphState, syncRunID int64, session *Session, stats SyncStats) (int, error) {
+	if len(previous.Channels) == 0 && len(previous.Nodes) == 0 {
+		log.Printf("No previous graph state, recording this sync as the baseline for graph events")
+		return 0, nil
+	}
+
+	events := DiffGraphStates(previous, current)
+	if err := SendGraphEvents(ctx, events, syncRunID, session, stats); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// SendGraphEvents stores the events of a sync in graph_events
+func SendGraphEvents(ctx context.Context, events []GraphEvent, syncRunID int64, session *Session, stats SyncStats) error {
+	log.Printf("Importing %d graph events to %s", len(events), session.sink.Name())
+
+	return session.withTx(ctx, func(tx *sql.Tx) error {
+		writer := newBatchWriter(ctx, session.sink, tx, graphEventsTable, stats)
+
+		for _, event := range events {
+			oldValue, err := marshalEventValue(event.OldValue)
+			if err != nil {
+				return err
+			}
+			newValue, err := marshalEventValue(event.NewValue)
+			if err != nil {
+				return err
+			}
+
+			err = writer.Add(
+				syncRunID,
+				event.Type,
+				event.ShortChannelID,
+				event.NodeID,
+				event.Direction,
+				oldValue,
+				newValue,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Process remaining records
+		return writer.Flush()
+	})
+}
+
+// marshalEventValue serializes an event value to JSON, keeping absent values NULL
+func marshalEventValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event value to JSON: %w", err)
+	}
+
+	return string(jsonBytes), nil
+}
+
+// graphEventsTable describes the insert of graph events
+var graphEventsTable = &Table{
+	Name: "graph_events",
+	Columns: []Column{
+		{"sync_run_id", ColumnValue},
+		{"event_type", ColumnValue},
+		{"short_channel_id", ColumnSCID},
+		{"node_id", ColumnKey},
+		{"direction", ColumnValue},
+		{"old_value", ColumnValue},
+		{"new_value", ColumnValue},
+	},
+	Now: []string{"created_at"},
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lnd-dbreader/models"
+)
+
+func TestLoadPreviousGraphStateToleratesMigratedRows(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	graph := &fakeGraph{
+		channels: []fakeChannel{testChannel(1, 2, 3, 1000)},
+		nodes:    []*models.LightningNode{testNode(2, "alice")},
+	}
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAddresses(ctx, graph, NewSession(sink), nil, nil); err != nil {
+		t.Fatalf("SendNodeAddresses failed: %v", err)
+	}
+
+	// Rows of older releases lack the migrated columns
+	for _, query := range []string{
+		"UPDATE node_announcements SET features = NULL",
+		"UPDATE channel_policies SET time_lock_delta = NULL, disabled = NULL WHERE direction = 1",
+	} {
+		if _, err := sink.DB().Exec(query); err != nil {
+			t.Fatalf("failed to clear columns: %v", err)
+		}
+	}
+
+	previous, err := LoadPreviousGraphState(ctx, NewSession(sink))
+	if err != nil {
+		t.Fatalf("LoadPreviousGraphState failed: %v", err)
+	}
+	if node := previous.Nodes[testKey(2)]; node == nil || node.Features != nil {
+		t.Errorf("got node state %+v, want unknown features", node)
+	}
+	if channel := previous.Channels[1]; channel == nil || channel.Policies[0] == nil || !channel.PolicyUnknown[1] {
+		t.Errorf("got channel state %+v, want policy 1 unknown", channel)
+	}
+
+	// The importers collect the current state, including the rows an
+	// incremental sync leaves untouched
+	filter, err := LoadIncrementalFilter(ctx, NewSession(sink))
+	if err != nil {
+		t.Fatalf("LoadIncrementalFilter failed: %v", err)
+	}
+	current := NewGraphState()
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), filter, current, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAnnouncements(ctx, graph, NewSession(sink), filter, current, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+	if len(current.Channels) != 1 || len(current.Nodes) != 1 {
+		t.Errorf("collected %d channels and %d nodes, want 1 and 1", len(current.Channels), len(current.Nodes))
+	}
+	if events := DiffGraphStates(previous, current); len(events) != 0 {
+		t.Errorf("got events %+v for an unchanged graph, want none", events)
+	}
+}
+
+// diffTestState returns a graph with channel 1 between nodes 2 and 3, both
+// policies, and node 2 with an alias, features and one address
+func diffTestState() *GraphState {
+	state := NewGraphState()
+	state.Channels[1] = &ChannelState{
+		NodeID1: testKey(2),
+		NodeID2: testKey(3),
+		Policies: [2]*PolicyState{
+			{FeeBaseMSat: 1000, FeeRateMilliMSat: 100, TimeLockDelta: 80, MinHTLCMSat: 1000, MaxHTLCMSat: 990000000},
+			{FeeBaseMSat: 1000, FeeRateMilliMSat: 100, TimeLockDelta: 80, MinHTLCMSat: 1000, MaxHTLCMSat: 990000000},
+		},
+	}
+
+	features := "0100"
+	addr := models.CustomAddress{Type: "ipv4", Address: "192.0.2.2", Port: 9735}
+	state.Nodes[testKey(2)] = &NodeState{
+		Alias:     "alice",
+		Features:  &features,
+		Addresses: map[string]models.CustomAddress{addressKey(addr): addr},
+	}
+
+	return state
+}
+
+func TestDiffGraphStates(t *testing.T) {
+	scid, newSCID := uint64(1), uint64(2)
+	node1, node2, node3 := testKey(2), testKey(3), testKey(4)
+	direction0, direction1 := 0, 1
+	basePolicy := *diffTestState().Channels[1].Policies[0]
+	newFeatures := "0300"
+	oldAddr := models.CustomAddress{Type: "ipv4", Address: "192.0.2.2", Port: 9735}
+	newAddr := models.CustomAddress{Type: "torv3", Address: "example.onion", Port: 9735}
+
+	tests := []struct {
+		name   string
+		change func(prev, cur *GraphState)
+		want   []GraphEvent
+	}{
+		{
+			name:   "unchanged",
+			change: func(prev, cur *GraphState) {},
+		},
+		{
+			name: "channel opened",
+			change: func(prev, cur *GraphState) {
+				cur.Channels[2] = &ChannelState{NodeID1: node2, NodeID2: node3}
+			},
+			want: []GraphEvent{{
+				Type:           EventChannelOpened,
+				ShortChannelID: &newSCID,
+				NewValue:       map[string]string{"node_id_1": node2, "node_id_2": node3},
+			}},
+		},
+		{
+			name:   "channel closed",
+			change: func(prev, cur *GraphState) { delete(cur.Channels, 1) },
+			want: []GraphEvent{{
+				Type:           EventChannelClosed,
+				ShortChannelID: &scid,
+				OldValue:       map[string]string{"node_id_1": node1, "node_id_2": node2},
+			}},
+		},
+		{
+			name:   "policy changed",
+			change: func(prev, cur *GraphState) { cur.Channels[1].Policies[1].FeeBaseMSat = 2000 },
+			want: []GraphEvent{{
+				Type:           EventPolicyChanged,
+				ShortChannelID: &scid,
+				NodeID:         &node2,
+				Direction:      &direction1,
+				OldValue:       &basePolicy,
+				NewValue:       &PolicyState{FeeBaseMSat: 2000, FeeRateMilliMSat: 100, TimeLockDelta: 80, MinHTLCMSat: 1000, MaxHTLCMSat: 990000000},
+			}},
+		},
+		{
+			name:   "policy added",
+			change: func(prev, cur *GraphState) { prev.Channels[1].Policies[0] = nil },
+			want: []GraphEvent{{
+				Type:           EventPolicyChanged,
+				ShortChannelID: &scid,
+				NodeID:         &node1,
+				Direction:      &direction0,
+				NewValue:       &basePolicy,
+			}},
+		},
+		{
+			name:   "policy removed",
+			change: func(prev, cur *GraphState) { cur.Channels[1].Policies[0] = nil },
+			want: []GraphEvent{{
+				Type:           EventPolicyChanged,
+				ShortChannelID: &scid,
+				NodeID:         &node1,
+				Direction:      &direction0,
+				OldValue:       &basePolicy,
+			}},
+		},
+		{
+			name: "incomplete previous policy",
+			change: func(prev, cur *GraphState) {
+				prev.Channels[1].Policies[0] = nil
+				prev.Channels[1].PolicyUnknown[0] = true
+			},
+		},
+		{
+			name:   "alias changed",
+			change: func(prev, cur *GraphState) { cur.Nodes[node1].Alias = "bob" },
+			want: []GraphEvent{{
+				Type:     EventNodeAliasChanged,
+				NodeID:   &node1,
+				OldValue: "alice",
+				NewValue: "bob",
+			}},
+		},
+		{
+			name:   "features changed",
+			change: func(prev, cur *GraphState) { cur.Nodes[node1].Features = &newFeatures },
+			want: []GraphEvent{{
+				Type:     EventFeatureChanged,
+				NodeID:   &node1,
+				OldValue: "0100",
+				NewValue: "0300",
+			}},
+		},
+		{
+			name:   "features unknown before",
+			change: func(prev, cur *GraphState) { prev.Nodes[node1].Features = nil },
+		},
+		{
+			name: "address replaced",
+			change: func(prev, cur *GraphState) {
+				cur.Nodes[node1].Addresses = map[string]models.CustomAddress{addressKey(newAddr): newAddr}
+			},
+			want: []GraphEvent{
+				{Type: EventAddressAdded, NodeID: &node1, NewValue: newAddr},
+				{Type: EventAddressRemoved, NodeID: &node1, OldValue: oldAddr},
+			},
+		},
+		{
+			name: "new node",
+			change: func(prev, cur *GraphState) {
+				cur.Nodes[node3] = &NodeState{Alias: "carol", Addresses: map[string]models.CustomAddress{}}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prev, cur := diffTestState(), diffTestState()
+			test.change(prev, cur)
+
+			got := DiffGraphStates(prev, cur)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got events\n%s\nwant\n%s", formatEvents(got), formatEvents(test.want))
+			}
+		})
+	}
+}
+
+// formatEvents renders events with their pointer fields dereferenced
+func formatEvents(events []GraphEvent) string {
+	var lines []string
+	for _, event := range events {
+		line := event.Type
+		if event.ShortChannelID != nil {
+			line += fmt.Sprintf(" scid=%d", *event.ShortChannelID)
+		}
+		if event.NodeID != nil {
+			line += " node=" + *event.NodeID
+		}
+		if event.Direction != nil {
+			line += fmt.Sprintf(" direction=%d", *event.Direction)
+		}
+		lines = append(lines, fmt.Sprintf("%s old=%+v new=%+v", line, event.OldValue, event.NewValue))
+	}
+
+	return strings.Join(lines, "\n")
+}
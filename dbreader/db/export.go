@@ -0,0 +1,223 @@
+/*
+Package db provides the reader that loads an export dataset from the database.
+
+LoadExportDataset reads the channels, policies, nodes and addresses a sync left
+in the tables, skipping rows marked as removed, so the exporters can write the
+graph of the last sync without a copy of channel.db.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"lnd-dbreader/export"
+)
+
+// LoadExportDataset reads the current graph from the tables of a sink
+func LoadExportDataset(ctx context.Context, sink Sink) (*export.Dataset, error) {
+	dataset := &export.Dataset{}
+
+	if err := loadExportChannels(ctx, sink, dataset); err != nil {
+		return nil, err
+	}
+	if err := loadExportPolicies(ctx, sink, dataset); err != nil {
+		return nil, err
+	}
+	if err := loadExportNodes(ctx, sink, dataset); err != nil {
+		return nil, err
+	}
+	if err := loadExportAddresses(ctx, sink, dataset); err != nil {
+		return nil, err
+	}
+
+	return dataset, nil
+}
+
+// loadExportChannels reads the channel announcements that were not removed
+func loadExportChannels(ctx context.Context, sink Sink, dataset *export.Dataset) error {
+	rows, err := sink.DB().QueryContext(ctx, fmt.Sprintf(`SELECT short_channel_id, %s, %s, %s, %s,
+		capacity_sat, funding_txid, funding_output_index, features
+		FROM channel_announcements WHERE removed_at IS NULL ORDER BY short_channel_id`,
+		sink.KeyText("node_id_1"), sink.KeyText("node_id_2"), sink.KeyText("bitcoin_key_1"), sink.KeyText("bitcoin_key_2")))
+	if err != nil {
+		return fmt.Errorf("failed to query channel announcements: %w", err)
+	}
+
+	for rows.Next() {
+		var channel export.Channel
+		var scid scanSCID
+		var node1, node2, bitcoinKey1, bitcoinKey2, fundingTxid, features sql.NullString
+		var capacity scanUint64
+		var fundingOutputIndex sql.NullInt64
+		err := rows.Scan(&scid, &node1, &node2, &bitcoinKey1, &bitcoinKey2,
+			&capacity, &fundingTxid, &fundingOutputIndex, &features)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan channel announcement: %w", err)
+		}
+
+		// Rows written before the capacity and funding columns existed leave them NULL
+		channel.ShortChannelID = uint64(scid)
+		channel.CapacitySat = int64(capacity.Uint64)
+		channel.FundingTxid = fundingTxid.String
+		channel.FundingOutputIndex = uint32(fundingOutputIndex.Int64)
+
+		for _, column := range []struct {
+			hex  sql.NullString
+			dest *[]byte
+		}{
+			{node1, &channel.NodeID1},
+			{node2, &channel.NodeID2},
+			{bitcoinKey1, &channel.BitcoinKey1},
+			{bitcoinKey2, &channel.BitcoinKey2},
+			{features, &channel.Features},
+		} {
+			if *column.dest, err = decodeHexColumn(column.hex); err != nil {
+				rows.Close()
+				return fmt.Errorf("channel %d: %w", channel.ShortChannelID, err)
+			}
+		}
+
+		dataset.Channels = append(dataset.Channels, channel)
+	}
+
+	return closeRows(rows)
+}
+
+// loadExportPolicies reads the channel policies that were not removed
+func loadExportPolicies(ctx context.Context, sink Sink, dataset *export.Dataset) error {
+	rows, err := sink.DB().QueryContext(ctx, fmt.Sprintf(`SELECT short_channel_id, direction, %s,
+		fee_base_msat, fee_rate_milli_msat, time_lock_delta, min_htlc_msat, max_htlc_msat,
+		message_flags, channel_flags, disabled, %s
+		FROM channel_policies WHERE removed_at IS NULL ORDER BY short_channel_id, direction`,
+		sink.KeyText("node_id"), sink.UnixSeconds("last_update")))
+	if err != nil {
+		return fmt.Errorf("failed to query channel policies: %w", err)
+	}
+
+	for rows.Next() {
+		var policy export.Policy
+		var scid scanSCID
+		var nodeID sql.NullString
+		var feeBase, feeRate, minHTLC, maxHTLC scanUint64
+		var timeLockDelta, messageFlags, channelFlags, lastUpdate sql.NullInt64
+		var disabled sql.NullBool
+		err := rows.Scan(&scid, &policy.Direction, &nodeID,
+			&feeBase, &feeRate, &timeLockDelta, &minHTLC, &maxHTLC,
+			&messageFlags, &channelFlags, &disabled, &lastUpdate)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan channel policy: %w", err)
+		}
+
+		// Only the key columns of channel_policies are NOT NULL
+		policy.ShortChannelID = uint64(scid)
+		policy.FeeBaseMsat = feeBase.Uint64
+		policy.FeeRateMilliMsat = feeRate.Uint64
+		policy.TimeLockDelta = uint32(timeLockDelta.Int64)
+		policy.MinHTLCMsat = minHTLC.Uint64
+		policy.MaxHTLCMsat = maxHTLC.Uint64
+		policy.MessageFlags = uint32(messageFlags.Int64)
+		policy.ChannelFlags = uint32(channelFlags.Int64)
+		policy.Disabled = disabled.Bool
+
+		if policy.NodeID, err = decodeHexColumn(nodeID); err != nil {
+			rows.Close()
+			return fmt.Errorf("policy of channel %d: %w", policy.ShortChannelID, err)
+		}
+		policy.LastUpdate = lastUpdate.Int64 * 1000
+
+		dataset.Policies = append(dataset.Policies, policy)
+	}
+
+	return closeRows(rows)
+}
+
+// loadExportNodes reads the node announcements that were not removed. The
+// announcement timestamp is only stored in json_data.
+func loadExportNodes(ctx context.Context, sink Sink, dataset *export.Dataset) error {
+	rows, err := sink.DB().QueryContext(ctx, fmt.Sprintf(`SELECT %s, alias, rgb_color, features, json_data
+		FROM node_announcements WHERE removed_at IS NULL ORDER BY node_id`,
+		sink.KeyText("node_id")))
+	if err != nil {
+		return fmt.Errorf("failed to query node announcements: %w", err)
+	}
+
+	for rows.Next() {
+		var node export.Node
+		var nodeID, alias, rgbColor, features, jsonData sql.NullString
+		if err := rows.Scan(&nodeID, &alias, &rgbColor, &features, &jsonData); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan node announcement: %w", err)
+		}
+
+		if node.NodeID, err = decodeHexColumn(nodeID); err != nil {
+			rows.Close()
+			return fmt.Errorf("node announcement: %w", err)
+		}
+		if node.Features, err = decodeHexColumn(features); err != nil {
+			rows.Close()
+			return fmt.Errorf("node %s: %w", nodeID.String, err)
+		}
+		node.Alias = alias.String
+		node.RGBColor = rgbColor.String
+
+		var announcement struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		if jsonData.Valid && json.Unmarshal([]byte(jsonData.String), &announcement) == nil && announcement.Timestamp > 0 {
+			node.LastUpdate = announcement.Timestamp * 1000
+		}
+
+		dataset.Nodes = append(dataset.Nodes, node)
+	}
+
+	return closeRows(rows)
+}
+
+// loadExportAddresses reads the node addresses that were not removed
+func loadExportAddresses(ctx context.Context, sink Sink, dataset *export.Dataset) error {
+	rows, err := sink.DB().QueryContext(ctx, fmt.Sprintf(`SELECT %s, address_type, address, port
+		FROM node_addresses WHERE removed_at IS NULL ORDER BY node_id, address, port`,
+		sink.KeyText("node_id")))
+	if err != nil {
+		return fmt.Errorf("failed to query node addresses: %w", err)
+	}
+
+	for rows.Next() {
+		var address export.Address
+		var nodeID, addressType sql.NullString
+		if err := rows.Scan(&nodeID, &addressType, &address.Address, &address.Port); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan node address: %w", err)
+		}
+
+		if address.NodeID, err = decodeHexColumn(nodeID); err != nil {
+			rows.Close()
+			return fmt.Errorf("node address: %w", err)
+		}
+		address.AddressType = addressType.String
+
+		dataset.Addresses = append(dataset.Addresses, address)
+	}
+
+	return closeRows(rows)
+}
+
+// decodeHexColumn decodes a hex text column; NULL and empty strings decode to nil
+func decodeHexColumn(value sql.NullString) ([]byte, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+
+	decoded, err := hex.DecodeString(value.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %w", value.String, err)
+	}
+
+	return decoded, nil
+}
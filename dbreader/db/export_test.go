@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLoadExportDatasetReadsMigratedRows(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(1, 2, 3, 1000)}}
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+
+	// Rows of older releases lack the migrated columns
+	for _, query := range []string{
+		"UPDATE channel_announcements SET capacity_sat = NULL, funding_txid = NULL, funding_output_index = NULL, features = NULL",
+		"UPDATE channel_policies SET time_lock_delta = NULL, disabled = NULL, last_update = NULL WHERE direction = 1",
+	} {
+		if _, err := sink.DB().Exec(query); err != nil {
+			t.Fatalf("failed to clear columns: %v", err)
+		}
+	}
+
+	dataset, err := LoadExportDataset(ctx, sink)
+	if err != nil {
+		t.Fatalf("LoadExportDataset failed: %v", err)
+	}
+
+	if len(dataset.Channels) != 1 || dataset.Channels[0].CapacitySat != 0 {
+		t.Errorf("got channels %+v, want channel 1 without capacity", dataset.Channels)
+	}
+	if len(dataset.Policies) != 2 || dataset.Policies[0].TimeLockDelta != 80 || dataset.Policies[1].TimeLockDelta != 0 {
+		t.Errorf("got policies %+v, want both policies of channel 1", dataset.Policies)
+	}
+}
@@ -0,0 +1,371 @@
+/*
+Package db provides incremental syncs driven by gossip timestamps.
+
+A full sync re-serializes and re-upserts every channel, policy and node. In
+incremental mode the importers only write entities that are new to the
+database or whose LastUpdate is newer than the one stored in their row, and
+channels whose authentication proof arrived or whose row predates the
+capacity and feature columns; everything else only gets its last_seen touched
+by bulk UPDATE statements.
+Comparing per row also catches gossip that reaches LND late, long after newer
+updates of other entities. The high-water marks in sync_watermarks only record
+the newest update seen, for monitoring.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"lnd-dbreader/models"
+)
+
+// Watermark entities stored in sync_watermarks.entity
+const (
+	WatermarkNodes    = "nodes"
+	WatermarkPolicies = "policies"
+)
+
+// policyKey identifies one direction of a channel
+type policyKey struct {
+	scid      uint64
+	direction int
+}
+
+// storedChannel is what the filter knows about a channel's stored row
+type storedChannel struct {
+	// hasProof is set when the row holds signatures or an unparsable proof
+	hasProof bool
+
+	// complete is set when the columns added by later releases are filled in
+	complete bool
+}
+
+// IncrementalFilter decides which graph entities an incremental sync writes and
+// collects the unchanged ones, whose rows are touched in bulk afterwards.
+// A nil filter makes every importer write everything, as in a full sync.
+type IncrementalFilter struct {
+	// marks holds the high-water marks stored by the previous sync
+	marks map[string]time.Time
+
+	// knownPolicies and knownNodes hold the stored LastUpdate in Unix seconds
+	knownChannels map[uint64]storedChannel
+	knownPolicies map[policyKey]int64
+	knownNodes    map[string]int64
+
+	maxNodeUpdate   time.Time
+	maxPolicyUpdate time.Time
+
+	unchangedChannels []interface{}
+	unchangedPolicies [2][]interface{}
+	unchangedNodes    []interface{}
+}
+
+// LoadIncrementalFilter reads the high-water marks and the keys and LastUpdate
+// of the rows present after the previous sync. On an empty database nothing is
+// known, so the first sync writes everything.
+func LoadIncrementalFilter(ctx context.Context, session *Session) (*IncrementalFilter, error) {
+	filter := &IncrementalFilter{
+		marks:         make(map[string]time.Time),
+		knownChannels: make(map[uint64]storedChannel),
+		knownPolicies: make(map[policyKey]int64),
+		knownNodes:    make(map[string]int64),
+	}
+
+	sink := session.sink
+
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT entity, %s FROM sync_watermarks WHERE high_water IS NOT NULL`,
+			sink.UnixSeconds("high_water")))
+		if err != nil {
+			return fmt.Errorf("failed to load sync watermarks: %w", err)
+		}
+		for rows.Next() {
+			var entity string
+			var highWater int64
+			if err := rows.Scan(&entity, &highWater); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan sync watermark: %w", err)
+			}
+			filter.marks[entity] = time.Unix(highWater, 0)
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT short_channel_id, capacity_sat, funding_txid, features,
+			%s, verification_status FROM channel_announcements
+			WHERE removed_at IS NULL AND short_channel_id IS NOT NULL`, sink.KeyText("node_signature_1")))
+		if err != nil {
+			return fmt.Errorf("failed to load known channels: %w", err)
+		}
+		for rows.Next() {
+			var scid scanSCID
+			var capacity sql.NullInt64
+			var fundingTxid, features, signature, status sql.NullString
+			if err := rows.Scan(&scid, &capacity, &fundingTxid, &features, &signature, &status); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan known channel: %w", err)
+			}
+			filter.knownChannels[uint64(scid)] = storedChannel{
+				hasProof: signature.String != "" || status.String == VerificationInvalid,
+				complete: capacity.Valid && fundingTxid.Valid && features.Valid,
+			}
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT short_channel_id, direction, %s FROM channel_policies
+			WHERE removed_at IS NULL`, sink.UnixSeconds("last_update")))
+		if err != nil {
+			return fmt.Errorf("failed to load known policies: %w", err)
+		}
+		for rows.Next() {
+			var scid scanSCID
+			var direction int
+			var lastUpdate sql.NullInt64
+			if err := rows.Scan(&scid, &direction, &lastUpdate); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan known policy: %w", err)
+			}
+			filter.knownPolicies[policyKey{scid: uint64(scid), direction: direction}] = lastUpdate.Int64
+		}
+		if err := closeRows(rows); err != nil {
+			return err
+		}
+
+		// The node timestamp is only stored in json_data. A node can have several
+		// rows (one per alias and color), the newest announcement counts.
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT %s, json_data FROM node_announcements
+			WHERE removed_at IS NULL AND node_id IS NOT NULL`, sink.KeyText("node_id")))
+		if err != nil {
+			return fmt.Errorf("failed to load known nodes: %w", err)
+		}
+		for rows.Next() {
+			var nodeID string
+			var jsonData sql.NullString
+			if err := rows.Scan(&nodeID, &jsonData); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan known node: %w", err)
+			}
+
+			var announcement struct {
+				Timestamp int64 `json:"timestamp"`
+			}
+			if jsonData.Valid {
+				// An unreadable row counts as outdated and is rewritten
+				_ = json.Unmarshal([]byte(jsonData.String), &announcement)
+			}
+			if stored, known := filter.knownNodes[nodeID]; !known || announcement.Timestamp > stored {
+				filter.knownNodes[nodeID] = announcement.Timestamp
+			}
+		}
+		return closeRows(rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Incremental import against %d known channels, %d known policies and %d known nodes",
+		len(filter.knownChannels), len(filter.knownPolicies), len(filter.knownNodes))
+	for _, entity := range []string{WatermarkNodes, WatermarkPolicies} {
+		if mark, ok := filter.marks[entity]; ok {
+			log.Printf("Newest %s update of the previous sync: %s", entity, mark.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return filter, nil
+}
+
+// channelChanged reports whether a channel announcement has to be written.
+// Announcements do not change once known, but the AuthProof of a channel is
+// added when its announcement is exchanged, and rows written before the
+// capacity and feature columns existed still have to be filled in.
+func (f *IncrementalFilter) channelChanged(edgeInfo *models.ChannelEdgeInfo) bool {
+	if f == nil {
+		return true
+	}
+
+	stored, known := f.knownChannels[edgeInfo.ChannelID]
+	return !known || !stored.complete || stored.hasProof != (edgeInfo.AuthProof != nil)
+}
+
+// policyChanged reports whether a directional policy is new or newer than its
+// stored row, and advances the policy high-water mark
+func (f *IncrementalFilter) policyChanged(scid uint64, direction int, lastUpdate time.Time) bool {
+	if f == nil {
+		return true
+	}
+
+	if lastUpdate.After(f.maxPolicyUpdate) {
+		f.maxPolicyUpdate = lastUpdate
+	}
+
+	stored, known := f.knownPolicies[policyKey{scid: scid, direction: direction}]
+	return !known || lastUpdate.Unix() > stored
+}
+
+// nodeChanged reports whether a node is new or newer than its stored row, in
+// which case its features and addresses are written as well, and advances the
+// node high-water mark. It gives the same answer for every importer that
+// iterates the nodes.
+func (f *IncrementalFilter) nodeChanged(nodeID string, lastUpdate time.Time) bool {
+	if f == nil {
+		return true
+	}
+
+	if lastUpdate.After(f.maxNodeUpdate) {
+		f.maxNodeUpdate = lastUpdate
+	}
+
+	stored, known := f.knownNodes[nodeID]
+	return !known || lastUpdate.Unix() > stored
+}
+
+// skipChannel records a channel whose row only needs its last_seen touched
+func (f *IncrementalFilter) skipChannel(scid uint64) {
+	f.unchangedChannels = append(f.unchangedChannels, scid)
+}
+
+// skipPolicy records a policy whose row only needs its last_seen touched
+func (f *IncrementalFilter) skipPolicy(scid uint64, direction int) {
+	f.unchangedPolicies[direction] = append(f.unchangedPolicies[direction], scid)
+}
+
+// skipNode records a node whose rows only need their last_seen touched
+func (f *IncrementalFilter) skipNode(nodeID string) {
+	f.unchangedNodes = append(f.unchangedNodes, nodeID)
+}
+
+// TouchUnchanged refreshes last_seen of every row the importers skipped, so that
+// MarkRemovedEntities keeps treating them as present, and stores the new
+// high-water marks. It must run after all importers and before MarkRemovedEntities.
+func TouchUnchanged(ctx context.Context, filter *IncrementalFilter, session *Session, stats SyncStats) error {
+	if filter == nil {
+		return nil
+	}
+
+	return session.withTx(ctx, func(tx *sql.Tx) error {
+		touches := []struct {
+			table     string
+			condition string
+			kind      ColumnKind
+			keys      []interface{}
+		}{
+			{"channel_announcements", "short_channel_id IN (%s)", ColumnSCID, filter.unchangedChannels},
+			{"channel_policies", "direction = 0 AND short_channel_id IN (%s)", ColumnSCID, filter.unchangedPolicies[0]},
+			{"channel_policies", "direction = 1 AND short_channel_id IN (%s)", ColumnSCID, filter.unchangedPolicies[1]},
+			{"node_announcements", "node_id IN (%s)", ColumnKey, filter.unchangedNodes},
+			{"node_features", "node_id IN (%s)", ColumnKey, filter.unchangedNodes},
+			{"node_addresses", "node_id IN (%s)", ColumnKey, filter.unchangedNodes},
+		}
+
+		for _, touch := range touches {
+			if err := touchRows(ctx, session.sink, tx, touch.table, touch.condition, touch.kind, touch.keys, stats.Table(touch.table)); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("Touched %d unchanged channels, %d unchanged policies and %d unchanged nodes",
+			len(filter.unchangedChannels), len(filter.unchangedPolicies[0])+len(filter.unchangedPolicies[1]),
+			len(filter.unchangedNodes))
+
+		return saveWatermarks(ctx, session.sink, tx, filter)
+	})
+}
+
+// touchRows sets last_seen on the present rows matching the keys, which are
+// values of a column of the given kind, in batches. Rows that are already
+// marked removed stay removed.
+func touchRows(ctx context.Context, sink Sink, tx *sql.Tx, table, condition string, kind ColumnKind, keys []interface{}, stats *TableStats) error {
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch, err := columnArgs(sink, kind, keys[start:end])
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf(`UPDATE %s SET last_seen = CURRENT_TIMESTAMP
+			WHERE removed_at IS NULL AND `+condition, table, placeholderList(len(batch)))
+
+		result, err := tx.ExecContext(ctx, sink.Rebind(query), batch...)
+		if err != nil {
+			return fmt.Errorf("failed to touch unchanged rows in %s: %w", table, err)
+		}
+
+		touched, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to count touched rows in %s: %w", table, err)
+		}
+
+		if stats != nil {
+			stats.Read += int64(len(batch))
+			stats.Touched += touched
+		}
+	}
+
+	return nil
+}
+
+// syncWatermarksTable describes the upsert of the high-water marks
+var syncWatermarksTable = &Table{
+	Name: "sync_watermarks",
+	Columns: []Column{
+		{"entity", ColumnValue},
+		{"high_water", ColumnUnixTime},
+	},
+	Key:    []string{"entity"},
+	Update: []string{"high_water"},
+	Touch:  []string{"updated_at"},
+	Now:    []string{"updated_at"},
+}
+
+// saveWatermarks stores the newest LastUpdate seen per entity type for
+// monitoring. A mark never moves backwards, even when the newest update of an
+// entity disappeared.
+func saveWatermarks(ctx context.Context, sink Sink, tx *sql.Tx, filter *IncrementalFilter) error {
+	marks := newBatchWriter(ctx, sink, tx, syncWatermarksTable, nil)
+
+	updates := []struct {
+		entity    string
+		highWater time.Time
+	}{
+		{WatermarkNodes, filter.maxNodeUpdate},
+		{WatermarkPolicies, filter.maxPolicyUpdate},
+	}
+
+	now := time.Now()
+	for _, update := range updates {
+		if update.highWater.IsZero() {
+			continue
+		}
+
+		// A timestamp from the future must not hide the updates of the next syncs
+		highWater := update.highWater
+		if highWater.After(now) {
+			highWater = now
+		}
+		if stored := filter.marks[update.entity]; stored.After(highWater) {
+			highWater = stored
+		}
+
+		if err := marks.Add(update.entity, highWater.Unix()); err != nil {
+			return err
+		}
+	}
+
+	if err := marks.Flush(); err != nil {
+		return fmt.Errorf("failed to save sync watermarks: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lnd-dbreader/models"
+)
+
+// incrementalSync runs the importers the way an incremental sync does
+func incrementalSync(t *testing.T, sink Sink, graph *fakeGraph) {
+	t.Helper()
+
+	ctx := context.Background()
+	session := NewSession(sink)
+
+	filter, err := LoadIncrementalFilter(ctx, session)
+	if err != nil {
+		t.Fatalf("LoadIncrementalFilter failed: %v", err)
+	}
+	if err := SendChannelAnnouncements(ctx, graph, session, filter, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAnnouncements(ctx, graph, session, filter, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+	if err := TouchUnchanged(ctx, filter, session, nil); err != nil {
+		t.Fatalf("TouchUnchanged failed: %v", err)
+	}
+}
+
+func TestIncrementalSyncImportsLateGossip(t *testing.T) {
+	sink := openTestSink(t)
+	start := time.Unix(1700000000, 0)
+
+	// Channel 2 and node 3 push the high-water marks ten hours past channel 1 and node 2
+	late := testChannel(1, 2, 3, 1000)
+	recent := testChannel(2, 3, 4, 1000)
+	for _, policy := range []*models.ChannelEdgePolicy{late.c1, late.c2} {
+		policy.LastUpdate = start
+	}
+	for _, policy := range []*models.ChannelEdgePolicy{recent.c1, recent.c2} {
+		policy.LastUpdate = start.Add(10 * time.Hour)
+	}
+	alice, bob := testNode(2, "alice"), testNode(3, "bob")
+	alice.LastUpdate = start
+	bob.LastUpdate = start.Add(10 * time.Hour)
+
+	graph := &fakeGraph{channels: []fakeChannel{late, recent}, nodes: []*models.LightningNode{alice, bob}}
+	incrementalSync(t, sink, graph)
+
+	// Updates that arrive late are newer than their rows but far older than the marks
+	graph.channels[0] = testChannel(1, 2, 3, 2000)
+	graph.channels[0].c1.LastUpdate = start.Add(time.Hour)
+	graph.channels[0].c2.LastUpdate = start
+	graph.nodes[0] = testNode(2, "alice")
+	graph.nodes[0].Alias = "carol"
+	graph.nodes[0].LastUpdate = start.Add(time.Hour)
+	incrementalSync(t, sink, graph)
+
+	if got := countRows(t, sink, "channel_policies", "short_channel_id = 1 AND direction = 0 AND fee_base_msat = 2000"); got != 1 {
+		t.Errorf("the late policy update of channel 1 was not written")
+	}
+	if got := countRows(t, sink, "channel_policies", "short_channel_id = 1 AND direction = 1 AND fee_base_msat = 1000"); got != 1 {
+		t.Errorf("the unchanged policy of channel 1 was overwritten")
+	}
+	if got := countRows(t, sink, "channel_policy_updates", "short_channel_id = 1"); got != 3 {
+		t.Errorf("got %d channel 1 policy versions, want 3", got)
+	}
+	if got := countRows(t, sink, "node_announcements", "node_id = ? AND alias = 'carol'", testKey(2)); got != 1 {
+		t.Errorf("the late announcement of node 2 was not written")
+	}
+}
+
+func TestIncrementalSyncRewritesIncompleteChannels(t *testing.T) {
+	sink := openTestSink(t)
+
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(1, 2, 3, 1000), testChannel(2, 3, 4, 1000)}}
+	incrementalSync(t, sink, graph)
+
+	// Rows of older releases lack the migrated columns
+	if _, err := sink.DB().Exec("UPDATE channel_announcements SET capacity_sat = NULL WHERE short_channel_id = 2"); err != nil {
+		t.Fatalf("failed to clear capacity: %v", err)
+	}
+
+	// The proof of channel 1 arrives after its announcement was stored; an
+	// unparsable one is stored as invalid, which shows that the row was rewritten
+	graph.channels[0].info.AuthProof = &models.ChannelAuthProof{
+		NodeSig1Bytes:    []byte{0x30, 0x06},
+		NodeSig2Bytes:    []byte{0x30, 0x06},
+		BitcoinSig1Bytes: []byte{0x30, 0x06},
+		BitcoinSig2Bytes: []byte{0x30, 0x06},
+	}
+	incrementalSync(t, sink, graph)
+
+	if got := countRows(t, sink, "channel_announcements", "short_channel_id = 1 AND verification_status = ?", VerificationInvalid); got != 1 {
+		t.Errorf("channel 1 was not rewritten with its proof")
+	}
+	if got := countRows(t, sink, "channel_announcements", "short_channel_id = 2 AND capacity_sat IS NOT NULL"); got != 1 {
+		t.Errorf("the migrated columns of channel 2 were not filled in")
+	}
+}
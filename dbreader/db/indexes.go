@@ -0,0 +1,142 @@
+/*
+Package db provides the import of LND graph channel indexes.
+
+This file stores the zombie edge index and the closed SCID index, which let
+us tell a channel that was closed on-chain from one that just went stale.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"lnd-dbreader/models"
+)
+
+// SendZombieChannels imports the zombie edge index from the LND graph
+func SendZombieChannels(ctx context.Context, indexes models.GraphIndexes, session *Session, stats SyncStats) error {
+	log.Printf("Importing zombie channels to %s", session.sink.Name())
+
+	count := 0
+
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		zombies := newBatchWriter(ctx, session.sink, tx, zombieChannelsTable, stats)
+
+		err := indexes.ForEachZombieChannel(func(chanID uint64, nodeKey1, nodeKey2 [33]byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			count++
+			return zombies.Add(
+				chanID,
+				hex.EncodeToString(nodeKey1[:]),
+				hex.EncodeToString(nodeKey2[:]),
+			)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to iterate zombie index: %w", err)
+		}
+
+		// Process remaining records
+		return zombies.Flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully imported %d zombie channels", count)
+	return nil
+}
+
+// zombieChannelsTable describes the upsert of zombie channels
+var zombieChannelsTable = &Table{
+	Name: "zombie_channels",
+	Columns: []Column{
+		{"short_channel_id", ColumnSCID},
+		{"node_id_1", ColumnKey},
+		{"node_id_2", ColumnKey},
+	},
+	Key:    []string{"short_channel_id"},
+	Update: []string{"node_id_1", "node_id_2"},
+	Touch:  []string{"last_seen"},
+	Clear:  []string{"removed_at"},
+	Now:    []string{"first_seen", "last_seen"},
+}
+
+// SendClosedChannels imports the closed SCID index from the LND graph.
+// The index holds SCIDs only, so the node pubkeys are filled in from the zombie
+// index and from channels we imported before they were closed.
+func SendClosedChannels(ctx context.Context, indexes models.GraphIndexes, session *Session, stats SyncStats) error {
+	log.Printf("Importing closed channels to %s", session.sink.Name())
+
+	count := 0
+
+	err := session.withTx(ctx, func(tx *sql.Tx) error {
+		closed := newBatchWriter(ctx, session.sink, tx, closedChannelsTable, stats)
+
+		err := indexes.ForEachClosedSCID(func(chanID uint64) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			count++
+			return closed.Add(chanID)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to iterate closed SCID index: %w", err)
+		}
+
+		// Process remaining records
+		if err := closed.Flush(); err != nil {
+			return err
+		}
+
+		// Backfill pubkeys, preferring the zombie index over our own channel history
+		for _, source := range []string{"zombie_channels", "channel_announcements"} {
+			if _, err := tx.ExecContext(ctx, closedChannelsBackfillQuery(source)); err != nil {
+				return fmt.Errorf("failed to backfill closed channel pubkeys: %w", err)
+			}
+		}
+
+		// Each SCID is looked up once, in the sync that first saw it. Closed
+		// channels are neither announced nor become zombies later, so the
+		// SCIDs still without pubkeys are not retried on every sync.
+		if _, err := tx.ExecContext(ctx, `UPDATE closed_channels SET backfilled_at = CURRENT_TIMESTAMP
+			WHERE backfilled_at IS NULL`); err != nil {
+			return fmt.Errorf("failed to mark closed channels as backfilled: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully imported %d closed channels", count)
+	return nil
+}
+
+// closedChannelsTable describes the upsert of closed channel SCIDs
+var closedChannelsTable = &Table{
+	Name:    "closed_channels",
+	Columns: []Column{{"short_channel_id", ColumnSCID}},
+	Key:     []string{"short_channel_id"},
+	Touch:   []string{"last_seen"},
+	Now:     []string{"first_seen", "last_seen"},
+}
+
+// closedChannelsBackfillQuery builds the update that copies the pubkeys of closed
+// channels not looked up before from source, using subqueries that MySQL,
+// PostgreSQL and SQLite all accept
+func closedChannelsBackfillQuery(source string) string {
+	return fmt.Sprintf(`UPDATE closed_channels SET
+		node_id_1 = (SELECT s.node_id_1 FROM %[1]s s WHERE s.short_channel_id = closed_channels.short_channel_id
+			ORDER BY s.last_seen DESC LIMIT 1),
+		node_id_2 = (SELECT s.node_id_2 FROM %[1]s s WHERE s.short_channel_id = closed_channels.short_channel_id
+			ORDER BY s.last_seen DESC LIMIT 1)
+		WHERE backfilled_at IS NULL AND node_id_1 IS NULL AND short_channel_id IN (SELECT short_channel_id FROM %[1]s)`, source)
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// fakeZombie is an entry of the zombie index of fakeIndexes
+type fakeZombie struct {
+	scid         uint64
+	node1, node2 byte
+}
+
+// fakeIndexes is an in-memory models.GraphIndexes
+type fakeIndexes struct {
+	zombies []fakeZombie
+	closed  []uint64
+}
+
+func (i *fakeIndexes) ForEachZombieChannel(cb func(chanID uint64, nodeKey1, nodeKey2 [33]byte) error) error {
+	for _, zombie := range i.zombies {
+		if err := cb(zombie.scid, testVertex(zombie.node1), testVertex(zombie.node2)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *fakeIndexes) ForEachClosedSCID(cb func(chanID uint64) error) error {
+	for _, scid := range i.closed {
+		if err := cb(scid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestSendZombieChannels(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	session := NewSession(sink)
+	stats := SyncStats{}
+
+	indexes := &fakeIndexes{zombies: []fakeZombie{{1, 2, 3}, {2, 3, 4}}}
+	if err := SendZombieChannels(ctx, indexes, session, stats); err != nil {
+		t.Fatalf("SendZombieChannels failed: %v", err)
+	}
+
+	// A zombie can be resurrected with a fresh announcement and die again
+	indexes.zombies[1] = fakeZombie{2, 4, 5}
+	if err := SendZombieChannels(ctx, indexes, session, stats); err != nil {
+		t.Fatalf("SendZombieChannels failed: %v", err)
+	}
+
+	if got := countRows(t, sink, "zombie_channels", ""); got != 2 {
+		t.Errorf("got %d zombie channels, want 2", got)
+	}
+	if got := countRows(t, sink, "zombie_channels", "short_channel_id = 2 AND node_id_1 = ? AND node_id_2 = ?",
+		testKey(4), testKey(5)); got != 1 {
+
+		t.Errorf("the pubkeys of zombie channel 2 were not updated")
+	}
+	if got := stats.Table("zombie_channels"); got.Read != 4 || got.Inserted != 2 {
+		t.Errorf("got %+v, want 4 read and 2 inserted zombie channels", *got)
+	}
+}
+
+func TestSendClosedChannelsBackfillsPubkeys(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	session := NewSession(sink)
+
+	// Channel 1 is a zombie that was also imported while it was open, channel
+	// 2 was only imported while open and channel 3 was never seen at all
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(1, 2, 3, 1000), testChannel(2, 3, 4, 1000)}}
+	if err := SendChannelAnnouncements(ctx, graph, session, nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	indexes := &fakeIndexes{
+		zombies: []fakeZombie{{1, 5, 6}},
+		closed:  []uint64{1, 2, 3},
+	}
+	if err := SendZombieChannels(ctx, indexes, session, nil); err != nil {
+		t.Fatalf("SendZombieChannels failed: %v", err)
+	}
+	if err := SendClosedChannels(ctx, indexes, session, nil); err != nil {
+		t.Fatalf("SendClosedChannels failed: %v", err)
+	}
+
+	// Channel 3 turns up in the zombie index after its SCID was looked up
+	indexes.zombies = append(indexes.zombies, fakeZombie{3, 7, 8})
+	if err := SendZombieChannels(ctx, indexes, session, nil); err != nil {
+		t.Fatalf("SendZombieChannels failed: %v", err)
+	}
+	if err := SendClosedChannels(ctx, indexes, session, nil); err != nil {
+		t.Fatalf("SendClosedChannels failed: %v", err)
+	}
+
+	tests := []struct {
+		scid         uint64
+		node1, node2 sql.NullString
+	}{
+		// The zombie index wins over our own channel history
+		{1, sql.NullString{String: testKey(5), Valid: true}, sql.NullString{String: testKey(6), Valid: true}},
+		{2, sql.NullString{String: testKey(3), Valid: true}, sql.NullString{String: testKey(4), Valid: true}},
+		// Each SCID is only looked up by the sync that first saw it
+		{3, sql.NullString{}, sql.NullString{}},
+	}
+	for _, tt := range tests {
+		var node1, node2 sql.NullString
+		var backfilled bool
+		err := sink.DB().QueryRow(`SELECT node_id_1, node_id_2, backfilled_at IS NOT NULL
+			FROM closed_channels WHERE short_channel_id = ?`, tt.scid).Scan(&node1, &node2, &backfilled)
+		if err != nil {
+			t.Fatalf("failed to read closed channel %d: %v", tt.scid, err)
+		}
+
+		if node1 != tt.node1 || node2 != tt.node2 {
+			t.Errorf("closed channel %d: got pubkeys %v, %v, want %v, %v", tt.scid, node1, node2, tt.node1, tt.node2)
+		}
+		if !backfilled {
+			t.Errorf("closed channel %d was not marked as backfilled", tt.scid)
+		}
+	}
+
+	if got := countRows(t, sink, "closed_channels", ""); got != 3 {
+		t.Errorf("got %d closed channels, want 3", got)
+	}
+}
@@ -2,15 +2,20 @@
 Package db provides database initialization for LND graph data storage.
 
 This file contains the MySQL table definitions required for storing
-channel announcements, node announcements, and node addresses from
-LND v0.19.1 graph database.
+channel announcements, channel policies and their history, node announcements,
+node features, node addresses, and the zombie and closed channel indexes from
+LND v0.19.1 graph database, as well as point-in-time graph snapshots, the
+graph_events change log, the incremental sync watermarks and the sync_runs
+audit table. The PostgreSQL definitions of the same tables are in postgres.go.
 */
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 )
 
 const createChannelAnnouncementsTable = `
@@ -21,59 +26,377 @@ CREATE TABLE IF NOT EXISTS channel_announcements (
   node_id_2 VARCHAR(66) NULL,
   bitcoin_key_1 VARCHAR(66) NULL,
   bitcoin_key_2 VARCHAR(66) NULL,
+  capacity_sat BIGINT UNSIGNED NULL,
+  funding_txid VARCHAR(64) NULL,
+  funding_output_index INT UNSIGNED NULL,
+  features TEXT NULL,
+  node_signature_1 VARCHAR(128) NULL,
+  node_signature_2 VARCHAR(128) NULL,
+  bitcoin_signature_1 VARCHAR(128) NULL,
+  bitcoin_signature_2 VARCHAR(128) NULL,
+  verification_status VARCHAR(16) NULL,
+  verified_at TIMESTAMP NULL,
   extra_opaque_data TEXT NULL,
   json_data JSON NULL,
   first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
   last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
   PRIMARY KEY (id),
   CONSTRAINT unique_channel UNIQUE (short_channel_id, node_id_1, node_id_2, bitcoin_key_1, bitcoin_key_2, extra_opaque_data(255))
 ) ENGINE = InnoDB;
 `
 
+const createChannelPoliciesTable = `
+CREATE TABLE IF NOT EXISTS channel_policies ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  short_channel_id BIGINT UNSIGNED NOT NULL,
+  direction TINYINT UNSIGNED NOT NULL,
+  node_id VARCHAR(66) NULL,
+  fee_base_msat BIGINT UNSIGNED NULL,
+  fee_rate_milli_msat BIGINT UNSIGNED NULL,
+  time_lock_delta SMALLINT UNSIGNED NULL,
+  min_htlc_msat BIGINT UNSIGNED NULL,
+  max_htlc_msat BIGINT UNSIGNED NULL,
+  message_flags TINYINT UNSIGNED NULL,
+  channel_flags TINYINT UNSIGNED NULL,
+  disabled BOOLEAN NULL,
+  last_update TIMESTAMP NULL,
+  first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_policy UNIQUE (short_channel_id, direction)
+) ENGINE = InnoDB;
+`
+
+const createChannelPolicyUpdatesTable = `
+CREATE TABLE IF NOT EXISTS channel_policy_updates ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  short_channel_id BIGINT UNSIGNED NOT NULL,
+  direction TINYINT UNSIGNED NOT NULL,
+  node_id VARCHAR(66) NULL,
+  fee_base_msat BIGINT UNSIGNED NOT NULL,
+  fee_rate_milli_msat BIGINT UNSIGNED NOT NULL,
+  time_lock_delta SMALLINT UNSIGNED NOT NULL,
+  min_htlc_msat BIGINT UNSIGNED NOT NULL,
+  max_htlc_msat BIGINT UNSIGNED NOT NULL,
+  message_flags TINYINT UNSIGNED NOT NULL,
+  channel_flags TINYINT UNSIGNED NOT NULL,
+  disabled BOOLEAN NULL,
+  last_update TIMESTAMP NOT NULL,
+  recorded_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_policy_update UNIQUE (short_channel_id, direction, last_update, fee_base_msat, fee_rate_milli_msat, time_lock_delta, min_htlc_msat, max_htlc_msat, message_flags, channel_flags),
+  INDEX idx_policy_updates_last_update (last_update)
+) ENGINE = InnoDB;
+`
+
 const createNodeAnnouncementsTable = `
 CREATE TABLE IF NOT EXISTS node_announcements ( 
   id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
   node_id VARCHAR(66) NULL,
   alias VARCHAR(255) NULL,
   rgb_color VARCHAR(7) NULL,
+  features TEXT NULL,
   json_data JSON NULL,
+  verification_status VARCHAR(16) NULL,
+  verified_at TIMESTAMP NULL,
   first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
   last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
   PRIMARY KEY (id),
   CONSTRAINT unique_node UNIQUE (node_id, alias, rgb_color)
 ) ENGINE = InnoDB;
 `
 
+const createNodeFeaturesTable = `
+CREATE TABLE IF NOT EXISTS node_features ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  node_id VARCHAR(66) NOT NULL,
+  bit SMALLINT UNSIGNED NOT NULL,
+  name VARCHAR(255) NULL,
+  required BOOLEAN NULL,
+  first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_node_feature UNIQUE (node_id, bit)
+) ENGINE = InnoDB;
+`
+
 const createNodeAddressesTable = `
 CREATE TABLE IF NOT EXISTS node_addresses ( 
   id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
   node_id VARCHAR(66) NOT NULL,
+  address_type VARCHAR(16) NULL,
   address VARCHAR(255) NOT NULL,
   port INT UNSIGNED NOT NULL,
   first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
   last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
   PRIMARY KEY (id),
   CONSTRAINT unique_address UNIQUE (node_id, address, port)
 ) ENGINE = InnoDB;
 `
 
-// InitializeDatabaseTables creates the required MySQL tables if they don't exist
-func InitializeDatabaseTables(db *sql.DB) error {
-	tables := []struct {
-		name string
-		sql  string
-	}{
-		{"channel_announcements", createChannelAnnouncementsTable},
-		{"node_announcements", createNodeAnnouncementsTable},
-		{"node_addresses", createNodeAddressesTable},
+const createZombieChannelsTable = `
+CREATE TABLE IF NOT EXISTS zombie_channels ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  short_channel_id BIGINT UNSIGNED NOT NULL,
+  node_id_1 VARCHAR(66) NULL,
+  node_id_2 VARCHAR(66) NULL,
+  first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_zombie_channel UNIQUE (short_channel_id)
+) ENGINE = InnoDB;
+`
+
+const createClosedChannelsTable = `
+CREATE TABLE IF NOT EXISTS closed_channels ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  short_channel_id BIGINT UNSIGNED NOT NULL,
+  node_id_1 VARCHAR(66) NULL,
+  node_id_2 VARCHAR(66) NULL,
+  backfilled_at TIMESTAMP NULL,
+  first_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_closed_channel UNIQUE (short_channel_id)
+) ENGINE = InnoDB;
+`
+
+const createGraphSnapshotsTable = `
+CREATE TABLE IF NOT EXISTS graph_snapshots ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  sync_run_id BIGINT UNSIGNED NULL,
+  taken_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  channel_count INT UNSIGNED NULL,
+  node_count INT UNSIGNED NULL,
+  PRIMARY KEY (id),
+  INDEX idx_graph_snapshots_taken_at (taken_at)
+) ENGINE = InnoDB;
+`
+
+const createSnapshotChannelsTable = `
+CREATE TABLE IF NOT EXISTS snapshot_channels ( 
+  snapshot_id BIGINT UNSIGNED NOT NULL,
+  short_channel_id BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (snapshot_id, short_channel_id)
+) ENGINE = InnoDB;
+`
+
+const createSnapshotNodesTable = `
+CREATE TABLE IF NOT EXISTS snapshot_nodes ( 
+  snapshot_id BIGINT UNSIGNED NOT NULL,
+  node_id VARCHAR(66) NOT NULL,
+  PRIMARY KEY (snapshot_id, node_id)
+) ENGINE = InnoDB;
+`
+
+const createGraphEventsTable = `
+CREATE TABLE IF NOT EXISTS graph_events ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  sync_run_id BIGINT UNSIGNED NULL,
+  event_type VARCHAR(32) NOT NULL,
+  short_channel_id BIGINT UNSIGNED NULL,
+  node_id VARCHAR(66) NULL,
+  direction TINYINT UNSIGNED NULL,
+  old_value JSON NULL,
+  new_value JSON NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_graph_events_type_created (event_type, created_at),
+  INDEX idx_graph_events_channel (short_channel_id),
+  INDEX idx_graph_events_node (node_id)
+) ENGINE = InnoDB;
+`
+
+const createSyncWatermarksTable = `
+CREATE TABLE IF NOT EXISTS sync_watermarks ( 
+  entity VARCHAR(32) NOT NULL,
+  high_water TIMESTAMP NULL,
+  updated_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (entity)
+) ENGINE = InnoDB;
+`
+
+const createSyncRunsTable = `
+CREATE TABLE IF NOT EXISTS sync_runs ( 
+  id BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  started_at TIMESTAMP NULL,
+  finished_at TIMESTAMP NULL,
+  status VARCHAR(16) NOT NULL,
+  source_size_bytes BIGINT UNSIGNED NULL,
+  source_mtime TIMESTAMP NULL,
+  duration_ms BIGINT UNSIGNED NULL,
+  table_stats JSON NULL,
+  phase_durations_ms JSON NULL,
+  verification_summary JSON NULL,
+  error_text TEXT NULL,
+  PRIMARY KEY (id),
+  INDEX idx_sync_runs_started_at (started_at)
+) ENGINE = InnoDB;
+`
+
+// columnMigration describes a column added to a table after its first release
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// columnMigrations lists the columns that existing installs are missing.
+// New installs already get them from the CREATE TABLE statements above.
+var columnMigrations = []columnMigration{
+	{"channel_announcements", "capacity_sat", "BIGINT UNSIGNED NULL AFTER bitcoin_key_2"},
+	{"channel_announcements", "funding_txid", "VARCHAR(64) NULL AFTER capacity_sat"},
+	{"channel_announcements", "funding_output_index", "INT UNSIGNED NULL AFTER funding_txid"},
+	{"channel_announcements", "features", "TEXT NULL AFTER funding_output_index"},
+	{"channel_announcements", "node_signature_1", "VARCHAR(128) NULL AFTER features"},
+	{"channel_announcements", "node_signature_2", "VARCHAR(128) NULL AFTER node_signature_1"},
+	{"channel_announcements", "bitcoin_signature_1", "VARCHAR(128) NULL AFTER node_signature_2"},
+	{"channel_announcements", "bitcoin_signature_2", "VARCHAR(128) NULL AFTER bitcoin_signature_1"},
+	{"channel_announcements", "verification_status", "VARCHAR(16) NULL AFTER json_data"},
+	{"channel_announcements", "verified_at", "TIMESTAMP NULL AFTER verification_status"},
+	{"node_announcements", "features", "TEXT NULL AFTER rgb_color"},
+	{"node_announcements", "verification_status", "VARCHAR(16) NULL AFTER json_data"},
+	{"node_announcements", "verified_at", "TIMESTAMP NULL AFTER verification_status"},
+	{"node_addresses", "address_type", "VARCHAR(16) NULL AFTER node_id"},
+	{"channel_announcements", "removed_at", "TIMESTAMP NULL AFTER last_seen"},
+	{"channel_policies", "removed_at", "TIMESTAMP NULL AFTER last_seen"},
+	{"node_announcements", "removed_at", "TIMESTAMP NULL AFTER last_seen"},
+	{"node_features", "removed_at", "TIMESTAMP NULL AFTER last_seen"},
+	{"node_addresses", "removed_at", "TIMESTAMP NULL AFTER last_seen"},
+	{"closed_channels", "backfilled_at", "TIMESTAMP NULL AFTER node_id_2"},
+	{"sync_runs", "verification_summary", "JSON NULL AFTER phase_durations_ms"},
+}
+
+// columnWidening describes a column released with a type too narrow for its
+// values. Existing columns of the old data type are changed to the definition.
+type columnWidening struct {
+	table      string
+	column     string
+	dataType   string
+	definition string
+}
+
+// columnWidenings lists the columns that existing installs created too narrow
+var columnWidenings = []columnWidening{
+	// Feature bits are announced by remote peers and their hex encoding has no practical limit
+	{"channel_announcements", "features", "varchar", "TEXT NULL"},
+	{"node_announcements", "features", "varchar", "TEXT NULL"},
+}
+
+// columnExists reports whether the column is present in the current database
+func columnExists(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.COLUMNS 
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column).Scan(&count)
+	if err != nil {
+		return false, err
 	}
 
+	return count > 0, nil
+}
+
+// columnDataType returns the data type of the column in the current database
+func columnDataType(ctx context.Context, db *sql.DB, table, column string) (string, error) {
+	var dataType string
+	err := db.QueryRowContext(ctx, `SELECT DATA_TYPE FROM information_schema.COLUMNS 
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column).Scan(&dataType)
+	if err != nil {
+		return "", err
+	}
+
+	return dataType, nil
+}
+
+// migrateDatabaseTables adds missing columns to tables created by older versions
+// and widens columns they created too narrow
+func migrateDatabaseTables(ctx context.Context, db *sql.DB) error {
+	for _, migration := range columnMigrations {
+		exists, err := columnExists(ctx, db, migration.table, migration.column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect column %s.%s: %w", migration.table, migration.column, err)
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", migration.table, migration.column, migration.definition)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", migration.table, migration.column, err)
+		}
+
+		log.Printf("Added column %s.%s", migration.table, migration.column)
+	}
+
+	for _, widening := range columnWidenings {
+		dataType, err := columnDataType(ctx, db, widening.table, widening.column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect column %s.%s: %w", widening.table, widening.column, err)
+		}
+		if !strings.EqualFold(dataType, widening.dataType) {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", widening.table, widening.column, widening.definition)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to widen column %s.%s: %w", widening.table, widening.column, err)
+		}
+
+		log.Printf("Widened column %s.%s to %s", widening.table, widening.column, widening.definition)
+	}
+
+	return nil
+}
+
+// tableDefinition is the CREATE TABLE statement of a table
+type tableDefinition struct {
+	name string
+	sql  string
+}
+
+// mysqlTables lists the MySQL tables in creation order
+var mysqlTables = []tableDefinition{
+	{"channel_announcements", createChannelAnnouncementsTable},
+	{"channel_policies", createChannelPoliciesTable},
+	{"channel_policy_updates", createChannelPolicyUpdatesTable},
+	{"node_announcements", createNodeAnnouncementsTable},
+	{"node_features", createNodeFeaturesTable},
+	{"node_addresses", createNodeAddressesTable},
+	{"zombie_channels", createZombieChannelsTable},
+	{"closed_channels", createClosedChannelsTable},
+	{"graph_snapshots", createGraphSnapshotsTable},
+	{"snapshot_channels", createSnapshotChannelsTable},
+	{"snapshot_nodes", createSnapshotNodesTable},
+	{"graph_events", createGraphEventsTable},
+	{"sync_watermarks", createSyncWatermarksTable},
+	{"sync_runs", createSyncRunsTable},
+}
+
+// createTables runs the CREATE TABLE statements of tables that don't exist yet
+func createTables(ctx context.Context, db *sql.DB, tables []tableDefinition) error {
 	for _, table := range tables {
-		if _, err := db.Exec(table.sql); err != nil {
+		if _, err := db.ExecContext(ctx, table.sql); err != nil {
 			return fmt.Errorf("failed to create table %s: %w", table.name, err)
 		}
 	}
 
+	return nil
+}
+
+// InitializeDatabaseTables creates the required tables if they don't exist
+// and migrates tables created by older versions to the current schema
+func InitializeDatabaseTables(ctx context.Context, sink Sink) error {
+	if err := sink.InitializeTables(ctx); err != nil {
+		return err
+	}
+
 	log.Printf("Database tables initialized successfully")
 	return nil
 }
@@ -0,0 +1,163 @@
+/*
+Package db provides the MySQL sink.
+
+MySQL is the original storage backend: keys are stored as hex strings, rows
+are upserted with ON DUPLICATE KEY UPDATE and the table definitions and
+column migrations are in initialization.go.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// mysqlSink writes the graph into MySQL
+type mysqlSink struct {
+	db *sql.DB
+}
+
+// Name identifies MySQL in log messages
+func (s *mysqlSink) Name() string {
+	return "MySQL"
+}
+
+// DB returns the MySQL connection pool
+func (s *mysqlSink) DB() *sql.DB {
+	return s.db
+}
+
+// InitializeTables creates the MySQL tables and adds columns missing in older installs
+func (s *mysqlSink) InitializeTables(ctx context.Context) error {
+	if err := createTables(ctx, s.db, mysqlTables); err != nil {
+		return err
+	}
+
+	return migrateDatabaseTables(ctx, s.db)
+}
+
+// Rebind returns the query unchanged, the MySQL driver uses ? placeholders
+func (s *mysqlSink) Rebind(query string) string {
+	return query
+}
+
+// UnixTime converts Unix seconds with FROM_UNIXTIME
+func (s *mysqlSink) UnixTime(expr string) string {
+	return "FROM_UNIXTIME(" + expr + ")"
+}
+
+// UnixSeconds converts a timestamp with UNIX_TIMESTAMP
+func (s *mysqlSink) UnixSeconds(expr string) string {
+	return "UNIX_TIMESTAMP(" + expr + ")"
+}
+
+// KeyValue keeps keys hex encoded, as MySQL stores them in VARCHAR columns
+func (s *mysqlSink) KeyValue(hexKey string) (interface{}, error) {
+	return hexKey, nil
+}
+
+// KeyText returns the column itself, it already holds hex text
+func (s *mysqlSink) KeyText(column string) string {
+	return column
+}
+
+// SCIDValue keeps the SCID, MySQL stores it in BIGINT UNSIGNED columns
+func (s *mysqlSink) SCIDValue(scid uint64) interface{} {
+	return scid
+}
+
+// MaxArgs returns the placeholder limit of MySQL prepared statements
+func (s *mysqlSink) MaxArgs() int {
+	return 65535
+}
+
+// mysqlDuplicatesVar is the session variable the upsert of tables whose existing
+// rows are never changed counts the duplicate rows in
+const mysqlDuplicatesVar = "@lnd_dbreader_duplicates"
+
+// upsert renders an INSERT ... ON DUPLICATE KEY UPDATE. Tables whose existing
+// rows are never changed keep id unchanged and count the duplicate in
+// mysqlDuplicatesVar instead of using INSERT IGNORE, which would also turn
+// NOT NULL violations and truncation into warnings.
+func (s *mysqlSink) upsert(table *Table, rows int) string {
+	query := renderInsert("INSERT", table, rows, s.UnixTime)
+
+	switch {
+	case len(table.Key) == 0:
+		return query
+	case table.ignoresDuplicates():
+		return query + "\n\t\tON DUPLICATE KEY UPDATE id = id + 0 * (" + mysqlDuplicatesVar + " := " + mysqlDuplicatesVar + " + 1)"
+	default:
+		return query + "\n\t\tON DUPLICATE KEY UPDATE\n\t\t" + renderAssignments(table, func(column string) string {
+			return "VALUES(" + column + ")"
+		})
+	}
+}
+
+// ExecUpsert runs the upsert and derives the counts from the affected rows.
+// The connection sets clientFoundRows, so ON DUPLICATE KEY UPDATE reports 1
+// affected row per inserted row, 2 per changed row and 1 per row that already
+// held the new values, and updated can never exceed the rows sent. Every upsert
+// touches a timestamp column, so an existing row only keeps its values when it
+// is written twice within one second; it then counts as inserted. With
+// clientFoundRows the ignored duplicates report 1 per row as well, so those
+// are counted by execInsertNew.
+func (s *mysqlSink) ExecUpsert(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (int64, int64, error) {
+	if table.ignoresDuplicates() {
+		return s.execInsertNew(ctx, q, table, rows, args)
+	}
+
+	result, err := q.ExecContext(ctx, s.upsert(table, rows), args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+
+	if len(table.Key) == 0 {
+		return affected, 0, nil
+	}
+
+	updated := affected - int64(rows)
+	return int64(rows) - updated, updated, nil
+}
+
+// execInsertNew inserts the rows not yet in a table whose existing rows are
+// left untouched. The upsert counts the duplicates in a session variable, which
+// concurrent writers cannot change; q is the transaction of a batchWriter, so
+// all three statements run on the same connection.
+func (s *mysqlSink) execInsertNew(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (int64, int64, error) {
+	if _, err := q.ExecContext(ctx, "SET "+mysqlDuplicatesVar+" = 0"); err != nil {
+		return 0, 0, fmt.Errorf("failed to reset duplicate counter: %w", err)
+	}
+
+	if _, err := q.ExecContext(ctx, s.upsert(table, rows), args...); err != nil {
+		return 0, 0, err
+	}
+
+	var duplicates int64
+	if err := q.QueryRowContext(ctx, "SELECT "+mysqlDuplicatesVar).Scan(&duplicates); err != nil {
+		return 0, 0, fmt.Errorf("failed to read duplicate counter: %w", err)
+	}
+
+	return int64(rows) - duplicates, 0, nil
+}
+
+// InsertID runs the INSERT and returns the AUTO_INCREMENT id it generated
+func (s *mysqlSink) InsertID(ctx context.Context, q querier, query string, args ...interface{}) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inserted id: %w", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,431 @@
+/*
+Package db provides the PostgreSQL sink.
+
+The PostgreSQL schema mirrors the MySQL tables in initialization.go with
+native types: pubkeys, signatures and opaque data are BYTEA, JSON documents
+JSONB and timestamps TIMESTAMPTZ. Unsigned integers are stored in the next
+larger signed type and millisatoshi amounts fit into BIGINT. SCIDs do not:
+alias SCIDs of option-scid-alias and zero-conf channels start at block
+16,000,000 and are 2^63 and above, so SCID columns hold the bit pattern of the
+SCID as a signed BIGINT and alias SCIDs read as negative numbers. Rows are
+upserted with ON CONFLICT, and RETURNING (xmax = 0) tells inserted rows from
+updated ones. It works unchanged on TimescaleDB.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const createPostgresChannelAnnouncementsTable = `
+CREATE TABLE IF NOT EXISTS channel_announcements (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  short_channel_id BIGINT NULL,
+  node_id_1 BYTEA NULL,
+  node_id_2 BYTEA NULL,
+  bitcoin_key_1 BYTEA NULL,
+  bitcoin_key_2 BYTEA NULL,
+  capacity_sat BIGINT NULL,
+  funding_txid VARCHAR(64) NULL,
+  funding_output_index BIGINT NULL,
+  features TEXT NULL,
+  node_signature_1 BYTEA NULL,
+  node_signature_2 BYTEA NULL,
+  bitcoin_signature_1 BYTEA NULL,
+  bitcoin_signature_2 BYTEA NULL,
+  verification_status VARCHAR(16) NULL,
+  verified_at TIMESTAMPTZ NULL,
+  extra_opaque_data BYTEA NULL,
+  json_data JSONB NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_channel UNIQUE (short_channel_id, node_id_1, node_id_2, bitcoin_key_1, bitcoin_key_2)
+);
+`
+
+const createPostgresChannelPoliciesTable = `
+CREATE TABLE IF NOT EXISTS channel_policies (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  short_channel_id BIGINT NOT NULL,
+  direction SMALLINT NOT NULL,
+  node_id BYTEA NULL,
+  fee_base_msat BIGINT NULL,
+  fee_rate_milli_msat BIGINT NULL,
+  time_lock_delta INTEGER NULL,
+  min_htlc_msat BIGINT NULL,
+  max_htlc_msat BIGINT NULL,
+  message_flags SMALLINT NULL,
+  channel_flags SMALLINT NULL,
+  disabled BOOLEAN NULL,
+  last_update TIMESTAMPTZ NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_policy UNIQUE (short_channel_id, direction)
+);
+`
+
+const createPostgresChannelPolicyUpdatesTable = `
+CREATE TABLE IF NOT EXISTS channel_policy_updates (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  short_channel_id BIGINT NOT NULL,
+  direction SMALLINT NOT NULL,
+  node_id BYTEA NULL,
+  fee_base_msat BIGINT NOT NULL,
+  fee_rate_milli_msat BIGINT NOT NULL,
+  time_lock_delta INTEGER NOT NULL,
+  min_htlc_msat BIGINT NOT NULL,
+  max_htlc_msat BIGINT NOT NULL,
+  message_flags SMALLINT NOT NULL,
+  channel_flags SMALLINT NOT NULL,
+  disabled BOOLEAN NULL,
+  last_update TIMESTAMPTZ NOT NULL,
+  recorded_at TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_policy_update UNIQUE (short_channel_id, direction, last_update, fee_base_msat, fee_rate_milli_msat, time_lock_delta, min_htlc_msat, max_htlc_msat, message_flags, channel_flags)
+);
+CREATE INDEX IF NOT EXISTS idx_policy_updates_last_update ON channel_policy_updates (last_update);
+`
+
+const createPostgresNodeAnnouncementsTable = `
+CREATE TABLE IF NOT EXISTS node_announcements (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  node_id BYTEA NULL,
+  alias VARCHAR(255) NULL,
+  rgb_color VARCHAR(7) NULL,
+  features TEXT NULL,
+  json_data JSONB NULL,
+  verification_status VARCHAR(16) NULL,
+  verified_at TIMESTAMPTZ NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_node UNIQUE (node_id, alias, rgb_color)
+);
+`
+
+// postgresColumnMigrations add the columns that earlier releases are missing
+const postgresColumnMigrations = `
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS verification_summary JSONB NULL;
+`
+
+const createPostgresNodeFeaturesTable = `
+CREATE TABLE IF NOT EXISTS node_features (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  node_id BYTEA NOT NULL,
+  bit INTEGER NOT NULL,
+  name VARCHAR(255) NULL,
+  required BOOLEAN NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_node_feature UNIQUE (node_id, bit)
+);
+`
+
+const createPostgresNodeAddressesTable = `
+CREATE TABLE IF NOT EXISTS node_addresses (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  node_id BYTEA NOT NULL,
+  address_type VARCHAR(16) NULL,
+  address VARCHAR(255) NOT NULL,
+  port INTEGER NOT NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_address UNIQUE (node_id, address, port)
+);
+`
+
+const createPostgresZombieChannelsTable = `
+CREATE TABLE IF NOT EXISTS zombie_channels (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  short_channel_id BIGINT NOT NULL,
+  node_id_1 BYTEA NULL,
+  node_id_2 BYTEA NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_zombie_channel UNIQUE (short_channel_id)
+);
+`
+
+const createPostgresClosedChannelsTable = `
+CREATE TABLE IF NOT EXISTS closed_channels (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  short_channel_id BIGINT NOT NULL,
+  node_id_1 BYTEA NULL,
+  node_id_2 BYTEA NULL,
+  backfilled_at TIMESTAMPTZ NULL,
+  first_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT unique_closed_channel UNIQUE (short_channel_id)
+);
+`
+
+const createPostgresGraphSnapshotsTable = `
+CREATE TABLE IF NOT EXISTS graph_snapshots (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  sync_run_id BIGINT NULL,
+  taken_at TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  channel_count INTEGER NULL,
+  node_count INTEGER NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_graph_snapshots_taken_at ON graph_snapshots (taken_at);
+`
+
+const createPostgresSnapshotChannelsTable = `
+CREATE TABLE IF NOT EXISTS snapshot_channels (
+  snapshot_id BIGINT NOT NULL,
+  short_channel_id BIGINT NOT NULL,
+  PRIMARY KEY (snapshot_id, short_channel_id)
+);
+`
+
+const createPostgresSnapshotNodesTable = `
+CREATE TABLE IF NOT EXISTS snapshot_nodes (
+  snapshot_id BIGINT NOT NULL,
+  node_id BYTEA NOT NULL,
+  PRIMARY KEY (snapshot_id, node_id)
+);
+`
+
+const createPostgresGraphEventsTable = `
+CREATE TABLE IF NOT EXISTS graph_events (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  sync_run_id BIGINT NULL,
+  event_type VARCHAR(32) NOT NULL,
+  short_channel_id BIGINT NULL,
+  node_id BYTEA NULL,
+  direction SMALLINT NULL,
+  old_value JSONB NULL,
+  new_value JSONB NULL,
+  created_at TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_graph_events_type_created ON graph_events (event_type, created_at);
+CREATE INDEX IF NOT EXISTS idx_graph_events_channel ON graph_events (short_channel_id);
+CREATE INDEX IF NOT EXISTS idx_graph_events_node ON graph_events (node_id);
+`
+
+const createPostgresSyncWatermarksTable = `
+CREATE TABLE IF NOT EXISTS sync_watermarks (
+  entity VARCHAR(32) NOT NULL,
+  high_water TIMESTAMPTZ NULL,
+  updated_at TIMESTAMPTZ NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (entity)
+);
+`
+
+const createPostgresSyncRunsTable = `
+CREATE TABLE IF NOT EXISTS sync_runs (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+  started_at TIMESTAMPTZ NULL,
+  finished_at TIMESTAMPTZ NULL,
+  status VARCHAR(16) NOT NULL,
+  source_size_bytes BIGINT NULL,
+  source_mtime TIMESTAMPTZ NULL,
+  duration_ms BIGINT NULL,
+  table_stats JSONB NULL,
+  phase_durations_ms JSONB NULL,
+  verification_summary JSONB NULL,
+  error_text TEXT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs (started_at);
+`
+
+// postgresTables lists the PostgreSQL tables in creation order
+var postgresTables = []tableDefinition{
+	{"channel_announcements", createPostgresChannelAnnouncementsTable},
+	{"channel_policies", createPostgresChannelPoliciesTable},
+	{"channel_policy_updates", createPostgresChannelPolicyUpdatesTable},
+	{"node_announcements", createPostgresNodeAnnouncementsTable},
+	{"node_features", createPostgresNodeFeaturesTable},
+	{"node_addresses", createPostgresNodeAddressesTable},
+	{"zombie_channels", createPostgresZombieChannelsTable},
+	{"closed_channels", createPostgresClosedChannelsTable},
+	{"graph_snapshots", createPostgresGraphSnapshotsTable},
+	{"snapshot_channels", createPostgresSnapshotChannelsTable},
+	{"snapshot_nodes", createPostgresSnapshotNodesTable},
+	{"graph_events", createPostgresGraphEventsTable},
+	{"sync_watermarks", createPostgresSyncWatermarksTable},
+	{"sync_runs", createPostgresSyncRunsTable},
+}
+
+// postgresSink writes the graph into PostgreSQL
+type postgresSink struct {
+	db *sql.DB
+}
+
+// Name identifies PostgreSQL in log messages
+func (s *postgresSink) Name() string {
+	return "PostgreSQL"
+}
+
+// DB returns the PostgreSQL connection pool
+func (s *postgresSink) DB() *sql.DB {
+	return s.db
+}
+
+// InitializeTables creates the PostgreSQL tables and migrates tables created
+// by earlier releases
+func (s *postgresSink) InitializeTables(ctx context.Context) error {
+	if err := createTables(ctx, s.db, postgresTables); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, postgresColumnMigrations); err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
+	return s.widenColumns(ctx)
+}
+
+// widenColumns changes the columnWidenings that earlier releases created as
+// VARCHAR to TEXT. ALTER COLUMN locks the table exclusively even when the type
+// is unchanged, so the current type is checked first.
+func (s *postgresSink) widenColumns(ctx context.Context) error {
+	for _, widening := range columnWidenings {
+		var dataType string
+		err := s.db.QueryRowContext(ctx, `SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`,
+			widening.table, widening.column).Scan(&dataType)
+		if err != nil {
+			return fmt.Errorf("failed to inspect column %s.%s: %w", widening.table, widening.column, err)
+		}
+		if dataType != "character varying" {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE TEXT", widening.table, widening.column)
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to widen column %s.%s: %w", widening.table, widening.column, err)
+		}
+
+		log.Printf("Widened column %s.%s to TEXT", widening.table, widening.column)
+	}
+
+	return nil
+}
+
+// Rebind numbers the ? placeholders as $1, $2, ...
+func (s *postgresSink) Rebind(query string) string {
+	var rebound strings.Builder
+	rebound.Grow(len(query) + 16)
+
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			rebound.WriteRune(r)
+			continue
+		}
+
+		n++
+		rebound.WriteByte('$')
+		rebound.WriteString(strconv.Itoa(n))
+	}
+
+	return rebound.String()
+}
+
+// UnixTime converts Unix seconds with to_timestamp
+func (s *postgresSink) UnixTime(expr string) string {
+	return "to_timestamp(CAST(" + expr + " AS BIGINT))"
+}
+
+// UnixSeconds truncates the epoch of a timestamp to whole seconds, like MySQL's UNIX_TIMESTAMP
+func (s *postgresSink) UnixSeconds(expr string) string {
+	return "CAST(FLOOR(EXTRACT(EPOCH FROM " + expr + ")) AS BIGINT)"
+}
+
+// KeyValue decodes hex keys for the BYTEA key columns
+func (s *postgresSink) KeyValue(hexKey string) (interface{}, error) {
+	return decodeHexKey(hexKey)
+}
+
+// KeyText encodes a BYTEA key column as hex text
+func (s *postgresSink) KeyText(column string) string {
+	return "encode(" + column + ", 'hex')"
+}
+
+// SCIDValue stores the bit pattern of the SCID in the signed BIGINT columns
+func (s *postgresSink) SCIDValue(scid uint64) interface{} {
+	return int64(scid)
+}
+
+// MaxArgs returns the placeholder limit of the PostgreSQL wire protocol
+func (s *postgresSink) MaxArgs() int {
+	return 65535
+}
+
+// upsert renders an INSERT ... ON CONFLICT on the table's key. Every inserted or
+// updated row returns whether it was inserted.
+func (s *postgresSink) upsert(table *Table, rows int) string {
+	query := renderInsert("INSERT", table, rows, s.UnixTime)
+
+	switch {
+	case len(table.Key) == 0:
+	case table.ignoresDuplicates():
+		query += fmt.Sprintf("\n\t\tON CONFLICT (%s) DO NOTHING", strings.Join(table.Key, ", "))
+	default:
+		query += fmt.Sprintf("\n\t\tON CONFLICT (%s) DO UPDATE SET\n\t\t%s", strings.Join(table.Key, ", "),
+			renderAssignments(table, func(column string) string {
+				return "EXCLUDED." + column
+			}))
+	}
+
+	return s.Rebind(query + "\n\t\tRETURNING (xmax = 0)")
+}
+
+// ExecUpsert runs the upsert and counts the rows it reports as inserted and updated
+func (s *postgresSink) ExecUpsert(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (int64, int64, error) {
+	result, err := q.QueryContext(ctx, s.upsert(table, rows), args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var inserted, updated int64
+	for result.Next() {
+		var isInsert bool
+		if err := result.Scan(&isInsert); err != nil {
+			result.Close()
+			return 0, 0, err
+		}
+
+		if isInsert {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := closeRows(result); err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, nil
+}
+
+// InsertID runs the INSERT with RETURNING id
+func (s *postgresSink) InsertID(ctx context.Context, q querier, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if err := q.QueryRowContext(ctx, s.Rebind(query)+" RETURNING id", args...).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
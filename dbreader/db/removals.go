@@ -0,0 +1,59 @@
+/*
+Package db provides detection of entities that disappeared from the LND graph.
+
+Rows are only ever upserted by the importers, so a channel pruned by LND keeps
+its old last_seen. After a complete sync every row that was not touched by it
+is marked with removed_at; the importers clear the mark again when an entity
+reappears.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// removalTables lists the tables whose rows are marked when they vanish from the graph
+var removalTables = []string{
+	"channel_announcements",
+	"channel_policies",
+	"node_announcements",
+	"node_features",
+	"node_addresses",
+	"zombie_channels",
+}
+
+// MarkRemovedEntities sets removed_at on every row that the sync started at
+// syncStartedAt (Unix seconds, database clock) did not see. It must only be
+// called after all importers of that sync completed successfully.
+func MarkRemovedEntities(ctx context.Context, session *Session, syncStartedAt int64, stats SyncStats) error {
+	return session.withTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range removalTables {
+			query := fmt.Sprintf(`UPDATE %s
+				SET removed_at = CURRENT_TIMESTAMP
+				WHERE removed_at IS NULL AND last_seen < %s`, table, session.sink.UnixTime("?"))
+
+			result, err := tx.ExecContext(ctx, session.sink.Rebind(query), syncStartedAt)
+			if err != nil {
+				return fmt.Errorf("failed to mark removed rows in %s: %w", table, err)
+			}
+
+			removed, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to count removed rows in %s: %w", table, err)
+			}
+
+			if tableStats := stats.Table(table); tableStats != nil {
+				tableStats.Removed += removed
+			}
+
+			if removed > 0 {
+				log.Printf("Marked %d rows in %s as removed", removed, table)
+			}
+		}
+
+		return nil
+	})
+}
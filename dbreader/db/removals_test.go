@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"lnd-dbreader/models"
+)
+
+// removalSync runs a complete sync of graph followed by the removal marking.
+// The rows of earlier syncs are first aged by an hour, since last_seen only has
+// a resolution of one second.
+func removalSync(t *testing.T, sink Sink, graph *fakeGraph) {
+	t.Helper()
+
+	ctx := context.Background()
+	session := NewSession(sink)
+
+	for _, table := range removalTables {
+		if _, err := sink.DB().Exec("UPDATE " + table + " SET last_seen = datetime(last_seen, '-1 hour')"); err != nil {
+			t.Fatalf("failed to age %s: %v", table, err)
+		}
+	}
+
+	var startedAt int64
+	if err := sink.DB().QueryRow("SELECT " + sink.UnixSeconds("CURRENT_TIMESTAMP")).Scan(&startedAt); err != nil {
+		t.Fatalf("failed to read the database clock: %v", err)
+	}
+
+	if err := SendChannelAnnouncements(ctx, graph, session, nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAnnouncements(ctx, graph, session, nil, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+	if err := SendNodeAddresses(ctx, graph, session, nil, nil); err != nil {
+		t.Fatalf("SendNodeAddresses failed: %v", err)
+	}
+	if err := MarkRemovedEntities(ctx, session, startedAt, nil); err != nil {
+		t.Fatalf("MarkRemovedEntities failed: %v", err)
+	}
+}
+
+func TestMarkRemovedEntities(t *testing.T) {
+	sink := openTestSink(t)
+
+	full := &fakeGraph{
+		channels: []fakeChannel{testChannel(1, 2, 3, 1000), testChannel(2, 3, 4, 1000)},
+		nodes:    []*models.LightningNode{testNode(2, "alice"), testNode(3, "bob"), testNode(4, "carol")},
+	}
+	// Channel 2 and node 4 were pruned by LND
+	pruned := &fakeGraph{channels: full.channels[:1], nodes: full.nodes[:2]}
+
+	removed := []struct {
+		table, condition string
+		args             []interface{}
+	}{
+		{"channel_announcements", "short_channel_id = 2", nil},
+		{"channel_policies", "short_channel_id = 2", nil},
+		{"node_announcements", "node_id = ?", []interface{}{testKey(4)}},
+		{"node_features", "node_id = ?", []interface{}{testKey(4)}},
+		{"node_addresses", "node_id = ?", []interface{}{testKey(4)}},
+	}
+	assertRemoved := func(step string, wantRemoved bool) {
+		t.Helper()
+
+		for _, rows := range removed {
+			want := countRows(t, sink, rows.table, rows.condition, rows.args...)
+			if want == 0 {
+				t.Fatalf("%s: no rows in %s where %s", step, rows.table, rows.condition)
+			}
+			if !wantRemoved {
+				want = 0
+			}
+			if got := countRows(t, sink, rows.table, "removed_at IS NOT NULL AND "+rows.condition, rows.args...); got != want {
+				t.Errorf("%s: got %d removed rows in %s where %s, want %d", step, got, rows.table, rows.condition, want)
+			}
+		}
+	}
+
+	removalSync(t, sink, full)
+	assertRemoved("first sync", false)
+
+	removalSync(t, sink, pruned)
+	assertRemoved("pruned sync", true)
+	for _, rows := range removed {
+		if got := countRows(t, sink, rows.table, "removed_at IS NOT NULL AND NOT ("+rows.condition+")", rows.args...); got != 0 {
+			t.Errorf("pruned sync: %d rows still in the graph were marked in %s", got, rows.table)
+		}
+	}
+
+	removalSync(t, sink, full)
+	assertRemoved("restoring sync", false)
+}
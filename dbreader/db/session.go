@@ -0,0 +1,123 @@
+/*
+Package db provides import sessions that group the importers' writes.
+
+By default every importer runs in its own transaction. An atomic session
+shares a single transaction between all importers of a sync, so readers see
+either the complete new graph or the previous one, never a mix of both.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Session hands out the transactions the importers write through
+type Session struct {
+	sink   Sink
+	shared *sql.Tx
+}
+
+// NewSession creates a session in which every importer commits on its own
+func NewSession(sink Sink) *Session {
+	return &Session{sink: sink}
+}
+
+// BeginAtomicSession creates a session whose importers all write into one
+// transaction that is only committed by Session.Commit. The transaction is
+// rolled back when ctx is cancelled before the commit.
+func BeginAtomicSession(ctx context.Context, sink Sink) (*Session, error) {
+	tx, err := sink.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin atomic sync transaction: %w", err)
+	}
+
+	return &Session{sink: sink, shared: tx}, nil
+}
+
+// IsAtomic reports whether all importers share a single transaction
+func (s *Session) IsAtomic() bool {
+	return s.shared != nil
+}
+
+// Commit commits the shared transaction of an atomic session
+func (s *Session) Commit() error {
+	if s.shared == nil {
+		return nil
+	}
+
+	if err := s.shared.Commit(); err != nil {
+		return fmt.Errorf("failed to commit atomic sync transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Rollback discards everything written in an atomic session
+func (s *Session) Rollback() error {
+	if s.shared == nil {
+		return nil
+	}
+
+	if err := s.shared.Rollback(); err != nil && err != sql.ErrTxDone {
+		return fmt.Errorf("failed to roll back atomic sync transaction: %w", err)
+	}
+
+	return nil
+}
+
+// withTx runs fn in the importer's transaction. The transaction is rolled back
+// when fn fails and committed otherwise; commit and rollback failures are returned.
+func (s *Session) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := s.rollback(tx); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	if err := s.commit(tx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// begin returns the transaction an importer should write into
+func (s *Session) begin(ctx context.Context) (*sql.Tx, error) {
+	if s.shared != nil {
+		return s.shared, nil
+	}
+
+	return s.sink.DB().BeginTx(ctx, nil)
+}
+
+// commit ends an importer's transaction; shared transactions are left open
+func (s *Session) commit(tx *sql.Tx) error {
+	if tx == s.shared {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// rollback aborts an importer's transaction; shared transactions are rolled
+// back as a whole by the session owner. A transaction whose context was
+// cancelled has already been rolled back by database/sql.
+func (s *Session) rollback(tx *sql.Tx) error {
+	if tx == s.shared {
+		return nil
+	}
+
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return err
+	}
+
+	return nil
+}
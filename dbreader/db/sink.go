@@ -0,0 +1,332 @@
+/*
+Package db provides the storage sinks the importers write through.
+
+The importers describe their destination tables declaratively with Table and
+queue rows in a batchWriter; a Sink renders the statements for its database.
+MySQL uses ON DUPLICATE KEY UPDATE and stores keys as hex strings, PostgreSQL
+uses ON CONFLICT, JSONB and BYTEA keys, and SQLite uses ON CONFLICT with hex
+keys in a single file. The few hand-written statements are written with ?
+placeholders and CURRENT_TIMESTAMP, which all three understand, and run
+through Rebind.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Storage backends selected by STORAGE_BACKEND
+const (
+	BackendMySQL    = "mysql"
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
+
+// ColumnKind tells a sink how to store the values of a column
+type ColumnKind int
+
+const (
+	// ColumnValue is stored as passed
+	ColumnValue ColumnKind = iota
+
+	// ColumnKey holds hex encoded binary data such as pubkeys and signatures
+	ColumnKey
+
+	// ColumnUnixTime holds Unix seconds stored as a timestamp
+	ColumnUnixTime
+
+	// ColumnSCID holds a short channel ID, given as uint64 or *uint64
+	ColumnSCID
+)
+
+// Column is a column written by an importer
+type Column struct {
+	Name string
+	Kind ColumnKind
+}
+
+// Table describes how the importers write a table
+type Table struct {
+	Name    string
+	Columns []Column
+
+	// Key is the unique key that identifies existing rows. Without a key every
+	// row is inserted.
+	Key []string
+
+	// Update lists the columns overwritten on an existing row, Touch the columns
+	// set to CURRENT_TIMESTAMP and Clear the columns set to NULL. When all three
+	// are empty, existing rows are left untouched.
+	Update []string
+	Touch  []string
+	Clear  []string
+
+	// Now lists the columns set to CURRENT_TIMESTAMP when a row is inserted
+	Now []string
+}
+
+// ignoresDuplicates reports whether existing rows are left untouched
+func (t *Table) ignoresDuplicates() bool {
+	return len(t.Key) > 0 && len(t.Update) == 0 && len(t.Touch) == 0 && len(t.Clear) == 0
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Sink is a database the graph is imported into
+type Sink interface {
+	// Name identifies the database in log messages
+	Name() string
+
+	// DB returns the connection pool of the sink
+	DB() *sql.DB
+
+	// InitializeTables creates missing tables and migrates tables of older versions
+	InitializeTables(ctx context.Context) error
+
+	// Rebind rewrites a statement written with ? placeholders for the driver
+	Rebind(query string) string
+
+	// UnixTime returns an expression converting Unix seconds to a timestamp
+	UnixTime(expr string) string
+
+	// UnixSeconds returns an expression converting a timestamp to Unix seconds
+	UnixSeconds(expr string) string
+
+	// KeyValue converts a hex encoded key to the value stored in key columns
+	KeyValue(hexKey string) (interface{}, error)
+
+	// KeyText returns an expression reading a key column as hex text
+	KeyText(column string) string
+
+	// SCIDValue converts a short channel ID to the value stored in SCID
+	// columns. Alias SCIDs are 2^63 and above, so databases without unsigned
+	// 64-bit integers store the bit pattern as a signed BIGINT; scanSCID
+	// converts it back.
+	SCIDValue(scid uint64) interface{}
+
+	// MaxArgs returns the placeholder limit of a single statement
+	MaxArgs() int
+
+	// ExecUpsert writes rows rows into table and counts inserted and updated rows
+	ExecUpsert(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (inserted, updated int64, err error)
+
+	// InsertID runs an INSERT written with ? placeholders into a table with an
+	// id column and returns the new id
+	InsertID(ctx context.Context, q querier, query string, args ...interface{}) (int64, error)
+}
+
+// NewSink wraps an open connection pool of the given backend
+func NewSink(backend string, db *sql.DB) (Sink, error) {
+	switch backend {
+	case BackendMySQL:
+		return &mysqlSink{db: db}, nil
+	case BackendPostgres:
+		return &postgresSink{db: db}, nil
+	case BackendSQLite:
+		return &sqliteSink{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// columnArgs converts args that are all values of a column of the given kind
+func columnArgs(sink Sink, kind ColumnKind, args []interface{}) ([]interface{}, error) {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		value, err := columnArg(sink, kind, arg)
+		if err != nil {
+			return nil, err
+		}
+		converted[i] = value
+	}
+
+	return converted, nil
+}
+
+// columnArg converts a key with KeyValue and an SCID with SCIDValue; other
+// values are kept
+func columnArg(sink Sink, kind ColumnKind, arg interface{}) (interface{}, error) {
+	switch kind {
+	case ColumnKey:
+		return keyArg(sink, arg)
+	case ColumnSCID:
+		return scidArg(sink, arg), nil
+	default:
+		return arg, nil
+	}
+}
+
+// scidArg converts a short channel ID, given as uint64 or *uint64, with SCIDValue
+func scidArg(sink Sink, arg interface{}) interface{} {
+	switch scid := arg.(type) {
+	case uint64:
+		return sink.SCIDValue(scid)
+	case *uint64:
+		if scid == nil {
+			return nil
+		}
+		return sink.SCIDValue(*scid)
+	default:
+		return arg
+	}
+}
+
+// scanSCID reads a short channel ID column stored by any sink: an unsigned
+// integer in MySQL or the bit pattern as a signed integer in the others
+type scanSCID uint64
+
+// Scan implements sql.Scanner
+func (s *scanSCID) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case int64:
+		*s = scanSCID(uint64(value))
+	case uint64:
+		*s = scanSCID(value)
+	case []byte:
+		return s.parse(string(value))
+	case string:
+		return s.parse(value)
+	default:
+		return fmt.Errorf("cannot scan %T into a short channel ID", src)
+	}
+
+	return nil
+}
+
+// parse reads a short channel ID returned as decimal text
+func (s *scanSCID) parse(text string) error {
+	value, err := parseUnsigned(text)
+	if err != nil {
+		return fmt.Errorf("cannot parse short channel ID %q: %w", text, err)
+	}
+	*s = scanSCID(value)
+	return nil
+}
+
+// scanUint64 reads a nullable BIGINT UNSIGNED column. database/sql converts
+// into int64 and fails on MySQL values at or above 2^63, so the column is
+// read like an SCID.
+type scanUint64 struct {
+	Uint64 uint64
+	Valid  bool
+}
+
+// Scan implements sql.Scanner
+func (s *scanUint64) Scan(src interface{}) error {
+	var err error
+	switch value := src.(type) {
+	case nil:
+		*s = scanUint64{}
+		return nil
+	case int64:
+		s.Uint64 = uint64(value)
+	case uint64:
+		s.Uint64 = value
+	case []byte:
+		s.Uint64, err = parseUnsigned(string(value))
+	case string:
+		s.Uint64, err = parseUnsigned(value)
+	default:
+		return fmt.Errorf("cannot scan %T into an unsigned integer", src)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse unsigned integer: %w", err)
+	}
+
+	s.Valid = true
+	return nil
+}
+
+// parseUnsigned reads decimal text as uint64, accepting the signed bit
+// pattern of values stored in a signed column
+func parseUnsigned(text string) (uint64, error) {
+	if unsigned, err := strconv.ParseUint(text, 10, 64); err == nil {
+		return unsigned, nil
+	}
+
+	signed, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(signed), nil
+}
+
+// keyArg converts a hex encoded key, given as string or *string, with KeyValue
+func keyArg(sink Sink, arg interface{}) (interface{}, error) {
+	switch key := arg.(type) {
+	case string:
+		return sink.KeyValue(key)
+	case *string:
+		if key == nil {
+			return nil, nil
+		}
+		return sink.KeyValue(*key)
+	default:
+		return arg, nil
+	}
+}
+
+// decodeHexKey decodes a hex encoded key for sinks that store keys as binary
+func decodeHexKey(hexKey string) (interface{}, error) {
+	value, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key %q: %w", hexKey, err)
+	}
+
+	return value, nil
+}
+
+// placeholderList returns n comma separated ? placeholders
+func placeholderList(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// renderInsert renders the INSERT of rows rows into table with ? placeholders,
+// converting Unix time columns with unixTime
+func renderInsert(verb string, table *Table, rows int, unixTime func(string) string) string {
+	names := make([]string, 0, len(table.Columns)+len(table.Now))
+	values := make([]string, 0, len(table.Columns)+len(table.Now))
+	for _, column := range table.Columns {
+		names = append(names, column.Name)
+		if column.Kind == ColumnUnixTime {
+			values = append(values, unixTime("?"))
+		} else {
+			values = append(values, "?")
+		}
+	}
+	for _, column := range table.Now {
+		names = append(names, column)
+		values = append(values, "CURRENT_TIMESTAMP")
+	}
+
+	row := "(" + strings.Join(values, ", ") + ")"
+	return fmt.Sprintf("%s INTO %s\n\t\t(%s)\n\t\tVALUES %s", verb, table.Name,
+		strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat(row+",", rows), ","))
+}
+
+// renderAssignments renders the assignments that update an existing row,
+// reading the new values with newValue
+func renderAssignments(table *Table, newValue func(column string) string) string {
+	assignments := make([]string, 0, len(table.Update)+len(table.Touch)+len(table.Clear))
+	for _, column := range table.Update {
+		assignments = append(assignments, fmt.Sprintf("%s = %s", column, newValue(column)))
+	}
+	for _, column := range table.Touch {
+		assignments = append(assignments, column+" = CURRENT_TIMESTAMP")
+	}
+	for _, column := range table.Clear {
+		assignments = append(assignments, column+" = NULL")
+	}
+
+	return strings.Join(assignments, ",\n\t\t")
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScanUint64(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want scanUint64
+	}{
+		{"NULL", nil, scanUint64{}},
+		{"signed", int64(990000000), scanUint64{990000000, true}},
+		{"bit pattern", int64(-1), scanUint64{math.MaxUint64, true}},
+		// MySQL returns BIGINT UNSIGNED columns as text
+		{"MySQL text above 2^63", []byte("18446744073709551615"), scanUint64{math.MaxUint64, true}},
+		{"string", "1000", scanUint64{1000, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := scanUint64{Uint64: 7, Valid: true}
+			if err := got.Scan(test.src); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	var invalid scanUint64
+	if err := invalid.Scan([]byte("fee")); err == nil {
+		t.Errorf("Scan accepted non-numeric text")
+	}
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"lnd-dbreader/models"
+)
+
+func TestTakeGraphSnapshotDaily(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	session := NewSession(sink)
+
+	// Channel 2 and node 4 were pruned, so the snapshot leaves them out
+	full := &fakeGraph{
+		channels: []fakeChannel{testChannel(1, 2, 3, 1000), testChannel(2, 3, 4, 1000)},
+		nodes:    []*models.LightningNode{testNode(2, "alice"), testNode(3, "bob"), testNode(4, "carol")},
+	}
+	removalSync(t, sink, full)
+	removalSync(t, sink, &fakeGraph{channels: full.channels[:1], nodes: full.nodes[:2]})
+
+	stats := SyncStats{}
+	for run, want := range []bool{true, false} {
+		taken, err := TakeGraphSnapshot(ctx, session, SnapshotDaily, int64(run+1), stats)
+		if err != nil {
+			t.Fatalf("TakeGraphSnapshot failed: %v", err)
+		}
+		if taken != want {
+			t.Errorf("run %d: got taken %v, want %v", run+1, taken, want)
+		}
+	}
+
+	if got := countRows(t, sink, "graph_snapshots", ""); got != 1 {
+		t.Fatalf("got %d snapshots, want 1", got)
+	}
+	if got := countRows(t, sink, "graph_snapshots", "sync_run_id = 1 AND channel_count = 1 AND node_count = 2"); got != 1 {
+		t.Errorf("the snapshot does not record 1 channel and 2 nodes")
+	}
+	if got := countRows(t, sink, "snapshot_channels", "short_channel_id = 1"); got != 1 || countRows(t, sink, "snapshot_channels", "") != 1 {
+		t.Errorf("snapshot_channels does not hold exactly channel 1")
+	}
+	if got := countRows(t, sink, "snapshot_nodes", "node_id IN (?, ?)", testKey(2), testKey(3)); got != 2 || countRows(t, sink, "snapshot_nodes", "") != 2 {
+		t.Errorf("snapshot_nodes does not hold exactly nodes 2 and 3")
+	}
+	if got := stats.Table("snapshot_channels").Inserted; got != 1 {
+		t.Errorf("got %d inserted snapshot channels, want 1", got)
+	}
+	if got := stats.Table("snapshot_nodes").Inserted; got != 2 {
+		t.Errorf("got %d inserted snapshot nodes, want 2", got)
+	}
+}
+
+func TestTakeGraphSnapshotEverySync(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+	session := NewSession(sink)
+
+	removalSync(t, sink, &fakeGraph{
+		channels: []fakeChannel{testChannel(1, 2, 3, 1000)},
+		nodes:    []*models.LightningNode{testNode(2, "alice"), testNode(3, "bob")},
+	})
+
+	for run := int64(1); run <= 2; run++ {
+		if taken, err := TakeGraphSnapshot(ctx, session, SnapshotSync, run, nil); err != nil || !taken {
+			t.Fatalf("run %d: got taken %v, error %v", run, taken, err)
+		}
+	}
+
+	if got := countRows(t, sink, "graph_snapshots", "channel_count = 1 AND node_count = 2"); got != 2 {
+		t.Errorf("got %d snapshots with 1 channel and 2 nodes, want 2", got)
+	}
+	if got := countRows(t, sink, "snapshot_channels", ""); got != 2 {
+		t.Errorf("got %d snapshot channels, want 2", got)
+	}
+}
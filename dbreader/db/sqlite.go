@@ -0,0 +1,418 @@
+/*
+Package db provides the SQLite sink.
+
+SQLite writes the graph into a single file that DuckDB, the sqlite3 CLI or any
+SQLite binding opens without a server. The schema mirrors the MySQL tables in
+initialization.go: keys stay hex encoded TEXT, JSON documents are TEXT and
+timestamps are TEXT in SQLite's "YYYY-MM-DD HH:MM:SS" UTC format, so they sort
+and compare like the timestamps of the server databases. SCIDs are stored as
+signed INTEGER bit patterns like on PostgreSQL. Rows are upserted with
+ON CONFLICT ... RETURNING rowid, and ExecUpsert tells inserted rows from
+updated ones by comparing the returned rowids with the largest one before the
+statement.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const createSQLiteChannelAnnouncementsTable = `
+CREATE TABLE IF NOT EXISTS channel_announcements (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  short_channel_id INTEGER NULL,
+  node_id_1 TEXT NULL,
+  node_id_2 TEXT NULL,
+  bitcoin_key_1 TEXT NULL,
+  bitcoin_key_2 TEXT NULL,
+  capacity_sat INTEGER NULL,
+  funding_txid TEXT NULL,
+  funding_output_index INTEGER NULL,
+  features TEXT NULL,
+  node_signature_1 TEXT NULL,
+  node_signature_2 TEXT NULL,
+  bitcoin_signature_1 TEXT NULL,
+  bitcoin_signature_2 TEXT NULL,
+  verification_status TEXT NULL,
+  verified_at TEXT NULL,
+  extra_opaque_data TEXT NULL,
+  json_data TEXT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_channel UNIQUE (short_channel_id, node_id_1, node_id_2, bitcoin_key_1, bitcoin_key_2)
+);
+`
+
+const createSQLiteChannelPoliciesTable = `
+CREATE TABLE IF NOT EXISTS channel_policies (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  short_channel_id INTEGER NOT NULL,
+  direction INTEGER NOT NULL,
+  node_id TEXT NULL,
+  fee_base_msat INTEGER NULL,
+  fee_rate_milli_msat INTEGER NULL,
+  time_lock_delta INTEGER NULL,
+  min_htlc_msat INTEGER NULL,
+  max_htlc_msat INTEGER NULL,
+  message_flags INTEGER NULL,
+  channel_flags INTEGER NULL,
+  disabled BOOLEAN NULL,
+  last_update TEXT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_policy UNIQUE (short_channel_id, direction)
+);
+`
+
+const createSQLiteChannelPolicyUpdatesTable = `
+CREATE TABLE IF NOT EXISTS channel_policy_updates (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  short_channel_id INTEGER NOT NULL,
+  direction INTEGER NOT NULL,
+  node_id TEXT NULL,
+  fee_base_msat INTEGER NOT NULL,
+  fee_rate_milli_msat INTEGER NOT NULL,
+  time_lock_delta INTEGER NOT NULL,
+  min_htlc_msat INTEGER NOT NULL,
+  max_htlc_msat INTEGER NOT NULL,
+  message_flags INTEGER NOT NULL,
+  channel_flags INTEGER NOT NULL,
+  disabled BOOLEAN NULL,
+  last_update TEXT NOT NULL,
+  recorded_at TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_policy_update UNIQUE (short_channel_id, direction, last_update, fee_base_msat, fee_rate_milli_msat, time_lock_delta, min_htlc_msat, max_htlc_msat, message_flags, channel_flags)
+);
+CREATE INDEX IF NOT EXISTS idx_policy_updates_last_update ON channel_policy_updates (last_update);
+`
+
+const createSQLiteNodeAnnouncementsTable = `
+CREATE TABLE IF NOT EXISTS node_announcements (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  node_id TEXT NULL,
+  alias TEXT NULL,
+  rgb_color TEXT NULL,
+  features TEXT NULL,
+  json_data TEXT NULL,
+  verification_status TEXT NULL,
+  verified_at TEXT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_node UNIQUE (node_id, alias, rgb_color)
+);
+`
+
+const createSQLiteNodeFeaturesTable = `
+CREATE TABLE IF NOT EXISTS node_features (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  node_id TEXT NOT NULL,
+  bit INTEGER NOT NULL,
+  name TEXT NULL,
+  required BOOLEAN NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_node_feature UNIQUE (node_id, bit)
+);
+`
+
+const createSQLiteNodeAddressesTable = `
+CREATE TABLE IF NOT EXISTS node_addresses (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  node_id TEXT NOT NULL,
+  address_type TEXT NULL,
+  address TEXT NOT NULL,
+  port INTEGER NOT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_address UNIQUE (node_id, address, port)
+);
+`
+
+const createSQLiteZombieChannelsTable = `
+CREATE TABLE IF NOT EXISTS zombie_channels (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  short_channel_id INTEGER NOT NULL,
+  node_id_1 TEXT NULL,
+  node_id_2 TEXT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  removed_at TEXT NULL,
+  CONSTRAINT unique_zombie_channel UNIQUE (short_channel_id)
+);
+`
+
+const createSQLiteClosedChannelsTable = `
+CREATE TABLE IF NOT EXISTS closed_channels (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  short_channel_id INTEGER NOT NULL,
+  node_id_1 TEXT NULL,
+  node_id_2 TEXT NULL,
+  backfilled_at TEXT NULL,
+  first_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_closed_channel UNIQUE (short_channel_id)
+);
+`
+
+const createSQLiteGraphSnapshotsTable = `
+CREATE TABLE IF NOT EXISTS graph_snapshots (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  sync_run_id INTEGER NULL,
+  taken_at TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  channel_count INTEGER NULL,
+  node_count INTEGER NULL
+);
+CREATE INDEX IF NOT EXISTS idx_graph_snapshots_taken_at ON graph_snapshots (taken_at);
+`
+
+const createSQLiteSnapshotChannelsTable = `
+CREATE TABLE IF NOT EXISTS snapshot_channels (
+  snapshot_id INTEGER NOT NULL,
+  short_channel_id INTEGER NOT NULL,
+  PRIMARY KEY (snapshot_id, short_channel_id)
+);
+`
+
+const createSQLiteSnapshotNodesTable = `
+CREATE TABLE IF NOT EXISTS snapshot_nodes (
+  snapshot_id INTEGER NOT NULL,
+  node_id TEXT NOT NULL,
+  PRIMARY KEY (snapshot_id, node_id)
+);
+`
+
+const createSQLiteGraphEventsTable = `
+CREATE TABLE IF NOT EXISTS graph_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  sync_run_id INTEGER NULL,
+  event_type TEXT NOT NULL,
+  short_channel_id INTEGER NULL,
+  node_id TEXT NULL,
+  direction INTEGER NULL,
+  old_value TEXT NULL,
+  new_value TEXT NULL,
+  created_at TEXT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_graph_events_type_created ON graph_events (event_type, created_at);
+CREATE INDEX IF NOT EXISTS idx_graph_events_channel ON graph_events (short_channel_id);
+CREATE INDEX IF NOT EXISTS idx_graph_events_node ON graph_events (node_id);
+`
+
+const createSQLiteSyncWatermarksTable = `
+CREATE TABLE IF NOT EXISTS sync_watermarks (
+  entity TEXT NOT NULL,
+  high_water TEXT NULL,
+  updated_at TEXT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (entity)
+);
+`
+
+const createSQLiteSyncRunsTable = `
+CREATE TABLE IF NOT EXISTS sync_runs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  started_at TEXT NULL,
+  finished_at TEXT NULL,
+  status TEXT NOT NULL,
+  source_size_bytes INTEGER NULL,
+  source_mtime TEXT NULL,
+  duration_ms INTEGER NULL,
+  table_stats TEXT NULL,
+  phase_durations_ms TEXT NULL,
+  verification_summary TEXT NULL,
+  error_text TEXT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs (started_at);
+`
+
+// sqliteTables lists the SQLite tables in creation order
+var sqliteTables = []tableDefinition{
+	{"channel_announcements", createSQLiteChannelAnnouncementsTable},
+	{"channel_policies", createSQLiteChannelPoliciesTable},
+	{"channel_policy_updates", createSQLiteChannelPolicyUpdatesTable},
+	{"node_announcements", createSQLiteNodeAnnouncementsTable},
+	{"node_features", createSQLiteNodeFeaturesTable},
+	{"node_addresses", createSQLiteNodeAddressesTable},
+	{"zombie_channels", createSQLiteZombieChannelsTable},
+	{"closed_channels", createSQLiteClosedChannelsTable},
+	{"graph_snapshots", createSQLiteGraphSnapshotsTable},
+	{"snapshot_channels", createSQLiteSnapshotChannelsTable},
+	{"snapshot_nodes", createSQLiteSnapshotNodesTable},
+	{"graph_events", createSQLiteGraphEventsTable},
+	{"sync_watermarks", createSQLiteSyncWatermarksTable},
+	{"sync_runs", createSQLiteSyncRunsTable},
+}
+
+// sqliteColumnMigrations lists the columns that files of earlier releases are
+// missing. SQLite appends added columns at the end of the table.
+var sqliteColumnMigrations = []columnMigration{
+	{"sync_runs", "verification_summary", "TEXT NULL"},
+}
+
+// sqliteSink writes the graph into an SQLite file
+type sqliteSink struct {
+	db *sql.DB
+}
+
+// Name identifies SQLite in log messages
+func (s *sqliteSink) Name() string {
+	return "SQLite"
+}
+
+// DB returns the SQLite connection pool
+func (s *sqliteSink) DB() *sql.DB {
+	return s.db
+}
+
+// InitializeTables creates the SQLite tables and adds columns missing in files
+// written by earlier releases
+func (s *sqliteSink) InitializeTables(ctx context.Context) error {
+	if err := createTables(ctx, s.db, sqliteTables); err != nil {
+		return err
+	}
+
+	for _, migration := range sqliteColumnMigrations {
+		var count int
+		err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+			migration.table, migration.column).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to inspect column %s.%s: %w", migration.table, migration.column, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", migration.table, migration.column, migration.definition)
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", migration.table, migration.column, err)
+		}
+	}
+
+	return nil
+}
+
+// Rebind returns the query unchanged, SQLite understands ? placeholders
+func (s *sqliteSink) Rebind(query string) string {
+	return query
+}
+
+// UnixTime converts Unix seconds with datetime
+func (s *sqliteSink) UnixTime(expr string) string {
+	return "datetime(" + expr + ", 'unixepoch')"
+}
+
+// UnixSeconds converts a timestamp with strftime
+func (s *sqliteSink) UnixSeconds(expr string) string {
+	return "CAST(strftime('%s', " + expr + ") AS INTEGER)"
+}
+
+// KeyValue keeps keys hex encoded, which is easier to query from the sqlite3 CLI
+func (s *sqliteSink) KeyValue(hexKey string) (interface{}, error) {
+	return hexKey, nil
+}
+
+// KeyText returns the column itself, it already holds hex text
+func (s *sqliteSink) KeyText(column string) string {
+	return column
+}
+
+// SCIDValue stores the bit pattern of the SCID, SQLite integers are signed
+// and the driver rejects uint64 values with the high bit set
+func (s *sqliteSink) SCIDValue(scid uint64) interface{} {
+	return int64(scid)
+}
+
+// MaxArgs returns SQLite's default SQLITE_MAX_VARIABLE_NUMBER
+func (s *sqliteSink) MaxArgs() int {
+	return 32766
+}
+
+// upsert renders an INSERT ... ON CONFLICT on the table's key
+func (s *sqliteSink) upsert(table *Table, rows int) string {
+	query := renderInsert("INSERT", table, rows, s.UnixTime)
+
+	switch {
+	case len(table.Key) == 0:
+		return query
+	case table.ignoresDuplicates():
+		return query + fmt.Sprintf("\n\t\tON CONFLICT (%s) DO NOTHING", strings.Join(table.Key, ", "))
+	default:
+		return query + fmt.Sprintf("\n\t\tON CONFLICT (%s) DO UPDATE SET\n\t\t%s", strings.Join(table.Key, ", "),
+			renderAssignments(table, func(column string) string {
+				return "excluded." + column
+			}))
+	}
+}
+
+// ExecUpsert runs the upsert and counts the rows it returns. SQLite hands out
+// rowids above the largest one in the table, so a returned rowid past the
+// largest one before the statement belongs to an inserted row and the other
+// returned rows were updated. DO NOTHING only returns inserted rows.
+func (s *sqliteSink) ExecUpsert(ctx context.Context, q querier, table *Table, rows int, args []interface{}) (int64, int64, error) {
+	if len(table.Key) == 0 {
+		result, err := q.ExecContext(ctx, s.upsert(table, rows), args...)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+		return inserted, 0, nil
+	}
+
+	// MAX(rowid) reads the last entry of the table's b-tree instead of scanning it
+	var lastRowID sql.NullInt64
+	if !table.ignoresDuplicates() {
+		if err := q.QueryRowContext(ctx, "SELECT MAX(rowid) FROM "+table.Name).Scan(&lastRowID); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	result, err := q.QueryContext(ctx, s.upsert(table, rows)+"\n\t\tRETURNING rowid", args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var inserted, updated int64
+	for result.Next() {
+		var rowID int64
+		if err := result.Scan(&rowID); err != nil {
+			result.Close()
+			return 0, 0, err
+		}
+
+		if rowID > lastRowID.Int64 {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := closeRows(result); err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, nil
+}
+
+// InsertID runs the INSERT and returns the rowid it generated
+func (s *sqliteSink) InsertID(ctx context.Context, q querier, query string, args ...interface{}) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inserted id: %w", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,182 @@
+/*
+Package db provides the sync_runs audit trail for LND graph imports.
+
+This file records every sync with its source file metadata, per-table row
+counters, per-phase durations, the signature verification summary and the
+error text of failed runs, so that freshness can be monitored from SQL.
+*/
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sync run statuses stored in sync_runs.status
+const (
+	SyncStatusRunning = "running"
+	SyncStatusSuccess = "success"
+	SyncStatusFailed  = "failed"
+)
+
+// TableStats counts the rows read from the graph and written to a single table.
+// Touched counts unchanged rows whose last_seen was refreshed by an incremental sync.
+type TableStats struct {
+	Read     int64 `json:"read"`
+	Inserted int64 `json:"inserted"`
+	Updated  int64 `json:"updated"`
+	Touched  int64 `json:"touched"`
+	Removed  int64 `json:"removed"`
+}
+
+// addCounts accounts for the inserted and updated rows of one executed batch
+func (s *TableStats) addCounts(inserted, updated int64) {
+	if s == nil {
+		return
+	}
+
+	s.Inserted += inserted
+	s.Updated += updated
+}
+
+// SyncStats collects the per-table counters of a single sync
+type SyncStats map[string]*TableStats
+
+// Table returns the counters of the named table, creating them on first use.
+// A nil SyncStats hands out nil counters, which silently discard updates.
+func (s SyncStats) Table(name string) *TableStats {
+	if s == nil {
+		return nil
+	}
+
+	stats, ok := s[name]
+	if !ok {
+		stats = &TableStats{}
+		s[name] = stats
+	}
+
+	return stats
+}
+
+// countRead increments the read counter of a table
+func (s *TableStats) countRead() {
+	if s != nil {
+		s.Read++
+	}
+}
+
+// SyncRun describes one execution of the import pipeline
+type SyncRun struct {
+	ID        int64
+	StartedAt time.Time
+
+	// DBStartedAt is the start of the run in Unix seconds according to the database clock.
+	// Rows whose last_seen is older were not touched by this run.
+	DBStartedAt int64
+
+	SourceSize    int64
+	SourceModTime time.Time
+	Tables        SyncStats
+	Phases        map[string]time.Duration
+
+	// Verification is the signature verification outcome, nil when it did not run
+	Verification *VerificationSummary
+}
+
+// NewSyncRun creates a sync run for the given source file metadata
+func NewSyncRun(sourceSize int64, sourceModTime time.Time) *SyncRun {
+	return &SyncRun{
+		StartedAt:     time.Now(),
+		SourceSize:    sourceSize,
+		SourceModTime: sourceModTime,
+		Tables:        make(SyncStats),
+		Phases:        make(map[string]time.Duration),
+	}
+}
+
+// TimePhase runs fn and records its duration under the given phase name
+func (r *SyncRun) TimePhase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	r.Phases[name] += time.Since(start)
+	return err
+}
+
+// StartSyncRun inserts the sync_runs row of a run that is about to start
+func StartSyncRun(ctx context.Context, sink Sink, run *SyncRun) error {
+	var sourceModTime interface{}
+	if !run.SourceModTime.IsZero() {
+		sourceModTime = run.SourceModTime.Unix()
+	}
+
+	// Use the database clock so the start is comparable with CURRENT_TIMESTAMP-based last_seen values
+	err := sink.DB().QueryRowContext(ctx, "SELECT "+sink.UnixSeconds("CURRENT_TIMESTAMP")).Scan(&run.DBStartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to read database time: %w", err)
+	}
+
+	run.ID, err = sink.InsertID(ctx, sink.DB(), fmt.Sprintf(`INSERT INTO sync_runs
+		(started_at, status, source_size_bytes, source_mtime)
+		VALUES (%s, ?, ?, %s)`, sink.UnixTime("?"), sink.UnixTime("?")),
+		run.DBStartedAt, SyncStatusRunning, run.SourceSize, sourceModTime)
+	if err != nil {
+		return fmt.Errorf("failed to insert sync run: %w", err)
+	}
+
+	return nil
+}
+
+// FinishSyncRun stores the outcome, counters, phase durations and verification
+// summary of a run.
+// It takes no context on purpose: a run interrupted by shutdown must still be
+// recorded as failed.
+func FinishSyncRun(sink Sink, run *SyncRun, runErr error) error {
+	status := SyncStatusSuccess
+	var errorText interface{}
+	if runErr != nil {
+		status = SyncStatusFailed
+		errorText = runErr.Error()
+	}
+
+	tableStats, err := json.Marshal(run.Tables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal table stats: %w", err)
+	}
+
+	phaseDurations := make(map[string]int64, len(run.Phases))
+	for phase, duration := range run.Phases {
+		phaseDurations[phase] = duration.Milliseconds()
+	}
+	phaseJSON, err := json.Marshal(phaseDurations)
+	if err != nil {
+		return fmt.Errorf("failed to marshal phase durations: %w", err)
+	}
+
+	var verificationSummary interface{}
+	if run.Verification != nil {
+		summaryJSON, err := json.Marshal(run.Verification)
+		if err != nil {
+			return fmt.Errorf("failed to marshal verification summary: %w", err)
+		}
+		verificationSummary = string(summaryJSON)
+	}
+
+	_, err = sink.DB().Exec(sink.Rebind(`UPDATE sync_runs SET
+		finished_at = CURRENT_TIMESTAMP,
+		status = ?,
+		duration_ms = ?,
+		table_stats = ?,
+		phase_durations_ms = ?,
+		verification_summary = ?,
+		error_text = ?
+		WHERE id = ?`),
+		status, time.Since(run.StartedAt).Milliseconds(), string(tableStats), string(phaseJSON), verificationSummary,
+		errorText, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update sync run %d: %w", run.ID, err)
+	}
+
+	return nil
+}
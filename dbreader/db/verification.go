@@ -0,0 +1,234 @@
+/*
+Package db provides signature verification for imported LND graph data.
+
+This file checks the authentication proof of every channel announcement and
+the signature of every node announcement against the announced public keys,
+and records the outcome next to the imported rows.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/netann"
+	"lnd-dbreader/models"
+)
+
+// Verification statuses stored in the verification_status columns
+const (
+	VerificationValid   = "valid"
+	VerificationInvalid = "invalid"
+	VerificationNoProof = "no_proof"
+)
+
+// VerificationSummary holds the per-sync outcome of signature verification.
+// It is stored in sync_runs.verification_summary.
+type VerificationSummary struct {
+	ChannelsValid   int `json:"channels_valid"`
+	ChannelsInvalid int `json:"channels_invalid"`
+	ChannelsNoProof int `json:"channels_no_proof"`
+	NodesValid      int `json:"nodes_valid"`
+	NodesInvalid    int `json:"nodes_invalid"`
+	NodesNoProof    int `json:"nodes_no_proof"`
+}
+
+// String returns a one-line summary suitable for logging
+func (s VerificationSummary) String() string {
+	return fmt.Sprintf("channels: %d valid, %d invalid, %d without proof; nodes: %d valid, %d invalid, %d without announcement",
+		s.ChannelsValid, s.ChannelsInvalid, s.ChannelsNoProof,
+		s.NodesValid, s.NodesInvalid, s.NodesNoProof)
+}
+
+// VerifyAnnouncements validates all channel and node signatures in the graph
+// and stores the result in the verification_status columns
+func VerifyAnnouncements(ctx context.Context, graph models.ChannelGraph, session *Session) (VerificationSummary, error) {
+	var summary VerificationSummary
+
+	// Group keys by status so each status is written with a few bulk updates
+	channelsByStatus := make(map[string][][]interface{})
+	err := graph.ForEachChannel(func(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		status := verifyChannelAnnouncement(edgeInfo)
+		channelsByStatus[status] = append(channelsByStatus[status], []interface{}{edgeInfo.ChannelID})
+
+		switch status {
+		case VerificationValid:
+			summary.ChannelsValid++
+		case VerificationInvalid:
+			summary.ChannelsInvalid++
+		default:
+			summary.ChannelsNoProof++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to iterate channels: %w", err)
+	}
+
+	nodesByStatus := make(map[string][][]interface{})
+	err = graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		node := nodeTx.Node()
+
+		// Only the row of the current alias and color holds this announcement
+		alias := node.Alias
+		if nodeAlias, err := lnwire.NewNodeAlias(node.Alias); err == nil {
+			alias = nodeAlias.String()
+		}
+
+		status := verifyNodeAnnouncement(node)
+		nodesByStatus[status] = append(nodesByStatus[status], []interface{}{
+			hex.EncodeToString(node.PubKeyBytes[:]),
+			alias,
+			fmt.Sprintf("#%02x%02x%02x", node.Color.R, node.Color.G, node.Color.B),
+		})
+
+		switch status {
+		case VerificationValid:
+			summary.NodesValid++
+		case VerificationInvalid:
+			summary.NodesInvalid++
+		default:
+			summary.NodesNoProof++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to iterate nodes: %w", err)
+	}
+
+	err = session.withTx(ctx, func(tx *sql.Tx) error {
+		for status, keys := range channelsByStatus {
+			if err := executeBatchVerificationStatus(ctx, session.sink, tx, channelVerificationRows, status, keys); err != nil {
+				return err
+			}
+		}
+
+		for status, keys := range nodesByStatus {
+			if err := executeBatchVerificationStatus(ctx, session.sink, tx, nodeVerificationRows, status, keys); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	log.Printf("Signature verification summary: %s", summary)
+	return summary, nil
+}
+
+// verifyChannelAnnouncement checks the node and bitcoin signatures of the edge's AuthProof
+func verifyChannelAnnouncement(edgeInfo *models.ChannelEdgeInfo) string {
+	chanAnn, err := models.NewCustomChannelAnnouncement(edgeInfo)
+	if err != nil {
+		return VerificationInvalid
+	}
+
+	if chanAnn.InvalidAuthProof {
+		return VerificationInvalid
+	}
+	if !chanAnn.HasAuthProof {
+		return VerificationNoProof
+	}
+
+	if err := netann.ValidateChannelAnn(chanAnn.ChannelAnnouncement1, nil); err != nil {
+		return VerificationInvalid
+	}
+
+	return VerificationValid
+}
+
+// verifyNodeAnnouncement checks the node announcement signature against the node's pubkey
+func verifyNodeAnnouncement(node *models.LightningNode) string {
+	if !node.HaveNodeAnnouncement {
+		return VerificationNoProof
+	}
+
+	nodeAnn, err := node.NodeAnnouncement(true)
+	if err != nil {
+		return VerificationInvalid
+	}
+
+	if err := netann.ValidateNodeAnn(nodeAnn); err != nil {
+		return VerificationInvalid
+	}
+
+	return VerificationValid
+}
+
+// verificationRows selects the rows of a table whose verification status is
+// set by the values of its key columns. Only rows not marked removed match.
+type verificationRows struct {
+	table   string
+	columns []Column
+}
+
+// channelVerificationRows selects a channel's announcement by its SCID
+var channelVerificationRows = verificationRows{
+	table:   "channel_announcements",
+	columns: []Column{{"short_channel_id", ColumnSCID}},
+}
+
+// nodeVerificationRows selects the announcement row of a node's current alias
+// and color; rows of earlier aliases and colors keep their status
+var nodeVerificationRows = verificationRows{
+	table:   "node_announcements",
+	columns: []Column{{"node_id", ColumnKey}, {"alias", ColumnValue}, {"rgb_color", ColumnValue}},
+}
+
+// executeBatchVerificationStatus sets the verification status of the rows with
+// the given keys, each holding the values of the key columns, in batches
+func executeBatchVerificationStatus(ctx context.Context, sink Sink, tx *sql.Tx, rows verificationRows, status string, keys [][]interface{}) error {
+	names := make([]string, len(rows.columns))
+	for i, column := range rows.columns {
+		names[i] = column.Name
+	}
+	tuple := "(" + placeholderList(len(names)) + ")"
+
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		args := []interface{}{status}
+		for _, key := range keys[start:end] {
+			for i, column := range rows.columns {
+				value, err := columnArg(sink, column.Kind, key[i])
+				if err != nil {
+					return err
+				}
+				args = append(args, value)
+			}
+		}
+
+		query := fmt.Sprintf(`UPDATE %s
+			SET verification_status = ?, verified_at = CURRENT_TIMESTAMP
+			WHERE removed_at IS NULL AND (%s) IN (%s)`, rows.table, strings.Join(names, ", "),
+			strings.TrimSuffix(strings.Repeat(tuple+",", end-start), ","))
+
+		if _, err := tx.ExecContext(ctx, sink.Rebind(query), args...); err != nil {
+			return fmt.Errorf("failed to update verification status of %s: %w", rows.table, err)
+		}
+	}
+
+	return nil
+}
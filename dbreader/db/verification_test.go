@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"lnd-dbreader/models"
+)
+
+func TestVerifyAnnouncementsMarksCurrentRowsOnly(t *testing.T) {
+	ctx := context.Background()
+	sink := openTestSink(t)
+
+	alice := testNode(2, "alice")
+	graph := &fakeGraph{channels: []fakeChannel{testChannel(1, 2, 3, 1000)}, nodes: []*models.LightningNode{alice}}
+	if err := SendNodeAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+
+	// The row of the old alias stays in node_announcements
+	alice.Alias = "carol"
+	if err := SendNodeAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendNodeAnnouncements failed: %v", err)
+	}
+	if err := SendChannelAnnouncements(ctx, graph, NewSession(sink), nil, nil, nil); err != nil {
+		t.Fatalf("SendChannelAnnouncements failed: %v", err)
+	}
+
+	summary, err := VerifyAnnouncements(ctx, graph, NewSession(sink))
+	if err != nil {
+		t.Fatalf("VerifyAnnouncements failed: %v", err)
+	}
+
+	// The test node carries no signature, the test channel no proof
+	if summary.NodesInvalid != 1 || summary.ChannelsNoProof != 1 {
+		t.Errorf("got summary %s, want one invalid node and one channel without proof", summary)
+	}
+	if got := countRows(t, sink, "node_announcements", "alias = 'carol' AND verification_status = ?", VerificationInvalid); got != 1 {
+		t.Errorf("the current announcement of node 2 was not marked invalid")
+	}
+	if got := countRows(t, sink, "node_announcements", "alias = 'alice' AND verification_status IS NULL"); got != 1 {
+		t.Errorf("the announcement of the old alias got a verification status")
+	}
+	if got := countRows(t, sink, "channel_announcements", "verification_status = ?", VerificationNoProof); got != 1 {
+		t.Errorf("the channel was not marked as without proof")
+	}
+
+	run := NewSyncRun(0, alice.LastUpdate)
+	if err := StartSyncRun(ctx, sink, run); err != nil {
+		t.Fatalf("StartSyncRun failed: %v", err)
+	}
+	run.Verification = &summary
+	if err := FinishSyncRun(sink, run, nil); err != nil {
+		t.Fatalf("FinishSyncRun failed: %v", err)
+	}
+	if got := countRows(t, sink, "sync_runs", "json_extract(verification_summary, '$.nodes_invalid') = 1"); got != 1 {
+		t.Errorf("the verification summary was not stored with the sync run")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Package main provides the export subcommand.
+
+An export writes the current channel graph to files instead of a database:
+
+	lnd-dbreader export --format parquet --out DIR         channels, policies, nodes and addresses as Parquet
+	lnd-dbreader export --format describegraph --out DIR   the JSON lncli describegraph prints
+	lnd-dbreader export --format graphml --out DIR         the network as GraphML for networkx and igraph
+	lnd-dbreader export --format gexf --out DIR            the network as GEXF for Gephi
+
+The graph is read from a private copy of channel.db like a sync does. All
+formats but describegraph, which needs the TLV records only the graph has, can
+also be read with --source database from the MySQL or PostgreSQL tables the
+last sync wrote.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"lnd-dbreader/db"
+	"lnd-dbreader/export"
+)
+
+// Export formats selected by --format
+const (
+	exportFormatParquet       = "parquet"
+	exportFormatDescribeGraph = "describegraph"
+	exportFormatGraphML       = "graphml"
+	exportFormatGEXF          = "gexf"
+)
+
+// datasetWriters write the formats that are built from an export.Dataset
+var datasetWriters = map[string]func(dataset *export.Dataset, dir string) error{
+	exportFormatParquet: export.WriteParquet,
+	exportFormatGraphML: export.WriteGraphML,
+	exportFormatGEXF:    export.WriteGEXF,
+}
+
+// Export sources selected by --source
+const (
+	exportSourceGraph    = "graph"
+	exportSourceDatabase = "database"
+)
+
+// runExport parses the export flags and writes the graph in the selected format
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", exportFormatParquet, "output format: parquet, describegraph, graphml or gexf")
+	source := flags.String("source", exportSourceGraph, `read the graph from a copy of channel.db ("graph") or from the tables of the last sync ("database")`)
+	out := flags.String("out", "export", "directory the files are written to")
+	includeUnannounced := flags.Bool("include-unannounced", false, "describegraph: also write channels without an announcement proof, like lncli describegraph --include_unannounced")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		return exitUsage
+	}
+	if _, ok := datasetWriters[*format]; !ok && *format != exportFormatDescribeGraph {
+		fmt.Fprintf(os.Stderr, "Unknown export format %q, expected %q, %q, %q or %q\n", *format,
+			exportFormatParquet, exportFormatDescribeGraph, exportFormatGraphML, exportFormatGEXF)
+		return exitUsage
+	}
+	if *source != exportSourceGraph && *source != exportSourceDatabase {
+		fmt.Fprintf(os.Stderr, "Unknown export source %q, expected %q or %q\n", *source, exportSourceGraph, exportSourceDatabase)
+		return exitUsage
+	}
+	if *format == exportFormatDescribeGraph && *source != exportSourceGraph {
+		fmt.Fprintf(os.Stderr, "The %s format can only be read from the graph\n", exportFormatDescribeGraph)
+		return exitUsage
+	}
+
+	log.Printf("Starting %s %s export", appName, appVersion)
+
+	config := loadConfig()
+
+	// SIGINT and SIGTERM abort a running export
+	ctx, cancel := setupGracefulShutdown()
+	defer cancel()
+
+	start := time.Now()
+	if *format == exportFormatDescribeGraph {
+		if err := exportDescribeGraph(ctx, config, *out, *includeUnannounced); err != nil {
+			log.Printf("❌ ERROR during export: %v", err)
+			return exitFailed
+		}
+
+		log.Printf("✅ Export completed in %v", time.Since(start).Round(time.Millisecond))
+		return exitSuccess
+	}
+
+	dataset, err := loadExportDataset(ctx, config, *source)
+	if err != nil {
+		log.Printf("❌ ERROR reading graph: %v", err)
+		return exitFailed
+	}
+	log.Printf("Read %d channels, %d policies, %d nodes and %d addresses",
+		len(dataset.Channels), len(dataset.Policies), len(dataset.Nodes), len(dataset.Addresses))
+
+	if err := datasetWriters[*format](dataset, *out); err != nil {
+		log.Printf("❌ ERROR during export: %v", err)
+		return exitFailed
+	}
+
+	log.Printf("✅ Export completed in %v", time.Since(start).Round(time.Millisecond))
+	return exitSuccess
+}
+
+// loadExportDataset reads the graph from the selected source
+func loadExportDataset(ctx context.Context, config *Config, source string) (*export.Dataset, error) {
+	if source == exportSourceDatabase {
+		store, err := openStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		defer store.Close()
+
+		if store.shared == nil {
+			return nil, fmt.Errorf("--source database reads MySQL or PostgreSQL, open the SQLite files directly instead")
+		}
+
+		log.Printf("Reading graph from %s", store.Describe())
+		return db.LoadExportDataset(ctx, store.shared)
+	}
+
+	log.Printf("Reading graph from %s", config.LNDDBPath)
+
+	graphCopy, err := openGraphCopy(ctx, config, db.NewSyncRun(0, time.Time{}))
+	if err != nil {
+		return nil, err
+	}
+	defer graphCopy.Close()
+
+	return export.ReadGraph(ctx, graphCopy.graph)
+}
+
+// exportDescribeGraph writes the lncli describegraph JSON of a copy of the graph
+func exportDescribeGraph(ctx context.Context, config *Config, out string, includeUnannounced bool) error {
+	log.Printf("Reading graph from %s", config.LNDDBPath)
+
+	graphCopy, err := openGraphCopy(ctx, config, db.NewSyncRun(0, time.Time{}))
+	if err != nil {
+		return err
+	}
+	defer graphCopy.Close()
+
+	return export.WriteDescribeGraph(ctx, graphCopy.graph, out, includeUnannounced)
+}
@@ -0,0 +1,192 @@
+/*
+Package export provides the exporters that write the channel graph to files.
+
+The exporters work on a Dataset, an in-memory copy of the current channels,
+directional policies, nodes and node addresses. ReadGraph fills it from the
+LND channel graph; db.LoadExportDataset fills it from the tables a sync wrote.
+The struct tags define the columns of the Parquet files.
+*/
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"lnd-dbreader/models"
+)
+
+// Channel is a channel announcement of the exported graph
+type Channel struct {
+	ShortChannelID     uint64 `parquet:"short_channel_id"`
+	NodeID1            []byte `parquet:"node_id_1"`
+	NodeID2            []byte `parquet:"node_id_2"`
+	BitcoinKey1        []byte `parquet:"bitcoin_key_1"`
+	BitcoinKey2        []byte `parquet:"bitcoin_key_2"`
+	CapacitySat        int64  `parquet:"capacity_sat"`
+	FundingTxid        string `parquet:"funding_txid"`
+	FundingOutputIndex uint32 `parquet:"funding_output_index"`
+	Features           []byte `parquet:"features"`
+}
+
+// Policy is the routing policy one side of a channel announced for its direction.
+// The 8 and 16 bit fields are widened to uint32, the smallest unsigned integer
+// the Parquet writer supports. LastUpdate is in Unix milliseconds.
+type Policy struct {
+	ShortChannelID   uint64 `parquet:"short_channel_id"`
+	Direction        uint32 `parquet:"direction"`
+	NodeID           []byte `parquet:"node_id"`
+	FeeBaseMsat      uint64 `parquet:"fee_base_msat"`
+	FeeRateMilliMsat uint64 `parquet:"fee_rate_milli_msat"`
+	TimeLockDelta    uint32 `parquet:"time_lock_delta"`
+	MinHTLCMsat      uint64 `parquet:"min_htlc_msat"`
+	MaxHTLCMsat      uint64 `parquet:"max_htlc_msat"`
+	MessageFlags     uint32 `parquet:"message_flags"`
+	ChannelFlags     uint32 `parquet:"channel_flags"`
+	Disabled         bool   `parquet:"disabled"`
+	LastUpdate       int64  `parquet:"last_update,timestamp(millisecond)"`
+}
+
+// Node is a node of the exported graph. LastUpdate is in Unix milliseconds;
+// nodes only known from channel announcements have no LastUpdate (written as
+// NULL), alias, color or features.
+type Node struct {
+	NodeID     []byte `parquet:"node_id"`
+	Alias      string `parquet:"alias"`
+	RGBColor   string `parquet:"rgb_color"`
+	Features   []byte `parquet:"features"`
+	LastUpdate int64  `parquet:"last_update,optional,timestamp(millisecond)"`
+}
+
+// Address is a network address a node announced
+type Address struct {
+	NodeID      []byte `parquet:"node_id"`
+	AddressType string `parquet:"address_type"`
+	Address     string `parquet:"address"`
+	Port        uint32 `parquet:"port"`
+}
+
+// Dataset is the graph an exporter writes
+type Dataset struct {
+	Channels  []Channel
+	Policies  []Policy
+	Nodes     []Node
+	Addresses []Address
+}
+
+// ReadGraph copies the channels, policies, nodes and addresses of the LND graph
+func ReadGraph(ctx context.Context, graph models.ChannelGraph) (*Dataset, error) {
+	dataset := &Dataset{}
+
+	err := graph.ForEachChannel(func(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Edge features are stored length-prefixed, as in the wire message
+		features := lnwire.NewRawFeatureVector()
+		if len(edgeInfo.Features) > 0 {
+			if err := features.Decode(bytes.NewReader(edgeInfo.Features)); err != nil {
+				return fmt.Errorf("failed to decode features of channel %d: %w", edgeInfo.ChannelID, err)
+			}
+		}
+
+		dataset.Channels = append(dataset.Channels, Channel{
+			ShortChannelID:     edgeInfo.ChannelID,
+			NodeID1:            cloneBytes(edgeInfo.NodeKey1Bytes[:]),
+			NodeID2:            cloneBytes(edgeInfo.NodeKey2Bytes[:]),
+			BitcoinKey1:        cloneBytes(edgeInfo.BitcoinKey1Bytes[:]),
+			BitcoinKey2:        cloneBytes(edgeInfo.BitcoinKey2Bytes[:]),
+			CapacitySat:        int64(edgeInfo.Capacity),
+			FundingTxid:        edgeInfo.ChannelPoint.Hash.String(),
+			FundingOutputIndex: edgeInfo.ChannelPoint.Index,
+			Features:           featureBytes(features),
+		})
+
+		// c1 belongs to node 1, c2 to node 2
+		for direction, policy := range []*models.ChannelEdgePolicy{c1, c2} {
+			if policy == nil {
+				continue
+			}
+
+			advertisingNode := edgeInfo.NodeKey1Bytes
+			if direction == 1 {
+				advertisingNode = edgeInfo.NodeKey2Bytes
+			}
+
+			dataset.Policies = append(dataset.Policies, Policy{
+				ShortChannelID:   edgeInfo.ChannelID,
+				Direction:        uint32(direction),
+				NodeID:           cloneBytes(advertisingNode[:]),
+				FeeBaseMsat:      uint64(policy.FeeBaseMSat),
+				FeeRateMilliMsat: uint64(policy.FeeProportionalMillionths),
+				TimeLockDelta:    uint32(policy.TimeLockDelta),
+				MinHTLCMsat:      uint64(policy.MinHTLC),
+				MaxHTLCMsat:      uint64(policy.MaxHTLC),
+				MessageFlags:     uint32(policy.MessageFlags),
+				ChannelFlags:     uint32(policy.ChannelFlags),
+				Disabled:         policy.IsDisabled(),
+				LastUpdate:       policy.LastUpdate.UnixMilli(),
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate channels: %w", err)
+	}
+
+	err = graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		node := nodeTx.Node()
+		nodeID := cloneBytes(node.PubKeyBytes[:])
+
+		exported := Node{NodeID: nodeID}
+		if node.HaveNodeAnnouncement {
+			exported.Alias = node.Alias
+			exported.RGBColor = fmt.Sprintf("#%02x%02x%02x", node.Color.R, node.Color.G, node.Color.B)
+			exported.LastUpdate = node.LastUpdate.UnixMilli()
+			if node.Features != nil {
+				exported.Features = featureBytes(node.Features.RawFeatureVector)
+			}
+		}
+		dataset.Nodes = append(dataset.Nodes, exported)
+
+		for _, addr := range node.Addresses {
+			customAddr := models.NewCustomAddress(addr)
+			dataset.Addresses = append(dataset.Addresses, Address{
+				NodeID:      nodeID,
+				AddressType: customAddr.Type,
+				Address:     customAddr.Address,
+				Port:        uint32(customAddr.Port),
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate nodes: %w", err)
+	}
+
+	return dataset, nil
+}
+
+// featureBytes returns the base256 wire encoding of a feature vector
+func featureBytes(features *lnwire.RawFeatureVector) []byte {
+	var buf bytes.Buffer
+	if err := features.EncodeBase256(&buf); err != nil {
+		return nil
+	}
+
+	return buf.Bytes()
+}
+
+// cloneBytes copies key bytes out of structs the graph iteration reuses
+func cloneBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,293 @@
+/*
+Package export provides the lncli describegraph exporter.
+
+WriteDescribeGraph marshals the graph the way lnd's DescribeGraph RPC does
+(marshalNode, marshalDBEdge and marshalDBRoutingPolicy in rpcserver.go) and
+writes it in the layout lncli prints: proto field names and order, every field
+present, 64-bit integers as strings, bytes as hex, map keys sorted numerically
+and a four space indent. lnrpc itself is only imported by the golden test,
+which compares the output with lncli's protojson encoding; that encoding needs
+lnd's hex-bytes protobuf fork, so go.mod repeats lnd's replace directive.
+*/
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/tlv"
+	"lnd-dbreader/models"
+)
+
+// DescribeGraphFile is the file name of the describegraph export within the output directory
+const DescribeGraphFile = "describegraph.json"
+
+// describeGraph mirrors lnrpc.ChannelGraph
+type describeGraph struct {
+	Nodes []describeGraphNode `json:"nodes"`
+	Edges []describeGraphEdge `json:"edges"`
+}
+
+// describeGraphNode mirrors lnrpc.LightningNode
+type describeGraphNode struct {
+	LastUpdate    uint32                                   `json:"last_update"`
+	PubKey        string                                   `json:"pub_key"`
+	Alias         string                                   `json:"alias"`
+	Addresses     []describeGraphAddress                   `json:"addresses"`
+	Color         string                                   `json:"color"`
+	Features      numericMap[uint32, describeGraphFeature] `json:"features"`
+	CustomRecords numericMap[uint64, string]               `json:"custom_records"`
+}
+
+// describeGraphAddress mirrors lnrpc.NodeAddress
+type describeGraphAddress struct {
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+}
+
+// describeGraphFeature mirrors lnrpc.Feature
+type describeGraphFeature struct {
+	Name       string `json:"name"`
+	IsRequired bool   `json:"is_required"`
+	IsKnown    bool   `json:"is_known"`
+}
+
+// describeGraphEdge mirrors lnrpc.ChannelEdge
+type describeGraphEdge struct {
+	ChannelID     uint64                     `json:"channel_id,string"`
+	ChanPoint     string                     `json:"chan_point"`
+	LastUpdate    uint32                     `json:"last_update"`
+	Node1Pub      string                     `json:"node1_pub"`
+	Node2Pub      string                     `json:"node2_pub"`
+	Capacity      int64                      `json:"capacity,string"`
+	Node1Policy   *describeGraphPolicy       `json:"node1_policy"`
+	Node2Policy   *describeGraphPolicy       `json:"node2_policy"`
+	CustomRecords numericMap[uint64, string] `json:"custom_records"`
+}
+
+// describeGraphPolicy mirrors lnrpc.RoutingPolicy
+type describeGraphPolicy struct {
+	TimeLockDelta           uint32                     `json:"time_lock_delta"`
+	MinHtlc                 int64                      `json:"min_htlc,string"`
+	FeeBaseMsat             int64                      `json:"fee_base_msat,string"`
+	FeeRateMilliMsat        int64                      `json:"fee_rate_milli_msat,string"`
+	Disabled                bool                       `json:"disabled"`
+	MaxHtlcMsat             uint64                     `json:"max_htlc_msat,string"`
+	LastUpdate              uint32                     `json:"last_update"`
+	CustomRecords           numericMap[uint64, string] `json:"custom_records"`
+	InboundFeeBaseMsat      int32                      `json:"inbound_fee_base_msat"`
+	InboundFeeRateMilliMsat int32                      `json:"inbound_fee_rate_milli_msat"`
+}
+
+// numericMap is a proto map with integer keys. encoding/json sorts the keys as
+// strings, protojson numerically, and an empty map is written as {} either way.
+type numericMap[K uint32 | uint64, V any] map[K]V
+
+// MarshalJSON writes the entries ordered by key
+func (m numericMap[K, V]) MarshalJSON() ([]byte, error) {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(m[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(strconv.Quote(strconv.FormatUint(uint64(key), 10)))
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// WriteDescribeGraph writes the graph as lncli describegraph JSON into dir.
+// Like lncli, channels without an announcement proof are left out unless
+// includeUnannounced is set.
+func WriteDescribeGraph(ctx context.Context, graph models.ChannelGraph, dir string, includeUnannounced bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	resp := describeGraph{
+		Nodes: []describeGraphNode{},
+		Edges: []describeGraphEdge{},
+	}
+
+	// Nodes first, then channels, in the order DescribeGraph visits them
+	err := graph.ForEachNode(func(nodeTx graphdb.NodeRTx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		resp.Nodes = append(resp.Nodes, marshalDescribeGraphNode(nodeTx.Node()))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate nodes: %w", err)
+	}
+
+	err = graph.ForEachChannel(func(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !includeUnannounced && edgeInfo.AuthProof == nil {
+			return nil
+		}
+
+		resp.Edges = append(resp.Edges, marshalDescribeGraphEdge(edgeInfo, c1, c2))
+		return nil
+	})
+	if err != nil && !errors.Is(err, graphdb.ErrGraphNoEdgesFound) {
+		return fmt.Errorf("failed to iterate channels: %w", err)
+	}
+
+	path := filepath.Join(dir, DescribeGraphFile)
+	err = writeFile(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(resp)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", DescribeGraphFile, err)
+	}
+
+	log.Printf("Wrote %d nodes and %d edges to %s", len(resp.Nodes), len(resp.Edges), path)
+	return nil
+}
+
+// marshalDescribeGraphNode follows lnd's marshalNode
+func marshalDescribeGraphNode(node *models.LightningNode) describeGraphNode {
+	addresses := make([]describeGraphAddress, len(node.Addresses))
+	for i, addr := range node.Addresses {
+		addresses[i] = describeGraphAddress{
+			Network: addr.Network(),
+			Addr:    addr.String(),
+		}
+	}
+
+	var features numericMap[uint32, describeGraphFeature]
+	if node.Features != nil {
+		features = make(numericMap[uint32, describeGraphFeature])
+		for bit := range node.Features.Features() {
+			features[uint32(bit)] = describeGraphFeature{
+				Name:       node.Features.Name(bit),
+				IsRequired: bit.IsRequired(),
+				IsKnown:    node.Features.IsKnown(bit),
+			}
+		}
+	}
+
+	return describeGraphNode{
+		LastUpdate:    uint32(node.LastUpdate.Unix()),
+		PubKey:        hex.EncodeToString(node.PubKeyBytes[:]),
+		Addresses:     addresses,
+		Alias:         node.Alias,
+		Color:         graphdb.EncodeHexColor(node.Color),
+		Features:      features,
+		CustomRecords: marshalCustomRecords(node.ExtraOpaqueData),
+	}
+}
+
+// marshalDescribeGraphEdge follows lnd's marshalDBEdge
+func marshalDescribeGraphEdge(edgeInfo *models.ChannelEdgeInfo, c1, c2 *models.ChannelEdgePolicy) describeGraphEdge {
+	// c1 has to be the policy of node 1 and c2 the one of node 2
+	if c1 != nil && c1.ChannelFlags&lnwire.ChanUpdateDirection == 1 ||
+		c2 != nil && c2.ChannelFlags&lnwire.ChanUpdateDirection == 0 {
+
+		c2, c1 = c1, c2
+	}
+
+	var lastUpdate int64
+	if c1 != nil {
+		lastUpdate = c1.LastUpdate.Unix()
+	}
+	if c2 != nil && c2.LastUpdate.Unix() > lastUpdate {
+		lastUpdate = c2.LastUpdate.Unix()
+	}
+
+	edge := describeGraphEdge{
+		ChannelID:     edgeInfo.ChannelID,
+		ChanPoint:     edgeInfo.ChannelPoint.String(),
+		LastUpdate:    uint32(lastUpdate),
+		Node1Pub:      hex.EncodeToString(edgeInfo.NodeKey1Bytes[:]),
+		Node2Pub:      hex.EncodeToString(edgeInfo.NodeKey2Bytes[:]),
+		Capacity:      int64(edgeInfo.Capacity),
+		CustomRecords: marshalCustomRecords(edgeInfo.ExtraOpaqueData),
+	}
+	if c1 != nil {
+		edge.Node1Policy = marshalDescribeGraphPolicy(c1)
+	}
+	if c2 != nil {
+		edge.Node2Policy = marshalDescribeGraphPolicy(c2)
+	}
+
+	return edge
+}
+
+// marshalDescribeGraphPolicy follows lnd's marshalDBRoutingPolicy
+func marshalDescribeGraphPolicy(policy *models.ChannelEdgePolicy) *describeGraphPolicy {
+	// A malformed TLV stream yields a zero inbound fee, as in lnd
+	var inboundFee lnwire.Fee
+	if _, err := policy.ExtraOpaqueData.ExtractRecords(&inboundFee); err != nil {
+		inboundFee = lnwire.Fee{}
+	}
+
+	return &describeGraphPolicy{
+		TimeLockDelta:           uint32(policy.TimeLockDelta),
+		MinHtlc:                 int64(policy.MinHTLC),
+		MaxHtlcMsat:             uint64(policy.MaxHTLC),
+		FeeBaseMsat:             int64(policy.FeeBaseMSat),
+		FeeRateMilliMsat:        int64(policy.FeeProportionalMillionths),
+		Disabled:                policy.ChannelFlags&lnwire.ChanUpdateDisabled != 0,
+		LastUpdate:              uint32(policy.LastUpdate.Unix()),
+		CustomRecords:           marshalCustomRecords(policy.ExtraOpaqueData),
+		InboundFeeBaseMsat:      inboundFee.BaseFee,
+		InboundFeeRateMilliMsat: inboundFee.FeeRate,
+	}
+}
+
+// marshalCustomRecords follows lnd's marshalExtraOpaqueData: the TLV records
+// of the extra opaque data with hex values, nil if they are malformed or empty
+func marshalCustomRecords(data []byte) numericMap[uint64, string] {
+	tlvStream, err := tlv.NewStream()
+	if err != nil {
+		return nil
+	}
+
+	// The data comes from peers, so it is decoded with the P2P limits
+	parsedTypes, err := tlvStream.DecodeWithParsedTypesP2P(bytes.NewReader(data))
+	if err != nil || len(parsedTypes) == 0 {
+		return nil
+	}
+
+	records := make(numericMap[uint64, string], len(parsedTypes))
+	for recordType, value := range parsedTypes {
+		records[uint64(recordType)] = hex.EncodeToString(value)
+	}
+
+	return records
+}
@@ -0,0 +1,263 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/color"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"lnd-dbreader/models"
+)
+
+// fakeChannel is a channel of fakeGraph with the policies ForEachChannel yields
+type fakeChannel struct {
+	info   *models.ChannelEdgeInfo
+	c1, c2 *models.ChannelEdgePolicy
+}
+
+// fakeGraph is an in-memory models.ChannelGraph
+type fakeGraph struct {
+	channels []fakeChannel
+	nodes    []*models.LightningNode
+}
+
+func (g *fakeGraph) ForEachChannel(cb func(*models.ChannelEdgeInfo, *models.ChannelEdgePolicy, *models.ChannelEdgePolicy) error) error {
+	for _, channel := range g.channels {
+		if err := cb(channel.info, channel.c1, channel.c2); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *fakeGraph) ForEachNode(cb func(graphdb.NodeRTx) error) error {
+	for _, node := range g.nodes {
+		if err := cb(&fakeNodeTx{node: node}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fakeNodeTx is the graphdb.NodeRTx of a fakeGraph node
+type fakeNodeTx struct {
+	node *models.LightningNode
+}
+
+func (n *fakeNodeTx) Node() *models.LightningNode {
+	return n.node
+}
+
+func (n *fakeNodeTx) ForEachChannel(func(*models.ChannelEdgeInfo, *models.ChannelEdgePolicy, *models.ChannelEdgePolicy) error) error {
+	return nil
+}
+
+func (n *fakeNodeTx) FetchNode(route.Vertex) (graphdb.NodeRTx, error) {
+	return nil, graphdb.ErrGraphNodeNotFound
+}
+
+// testVertex returns a node key filled with b
+func testVertex(b byte) [33]byte {
+	key := [33]byte{0x02}
+	for i := 1; i < len(key); i++ {
+		key[i] = b
+	}
+
+	return key
+}
+
+// testEdge returns a channel between the nodes 1 and 2 without policies
+func testEdge(scid uint64, announced bool) *models.ChannelEdgeInfo {
+	info := &models.ChannelEdgeInfo{
+		ChannelID:     scid,
+		NodeKey1Bytes: testVertex(1),
+		NodeKey2Bytes: testVertex(2),
+		Capacity:      1000000,
+	}
+	for i := range info.ChannelPoint.Hash {
+		info.ChannelPoint.Hash[i] = 0x11
+	}
+	info.ChannelPoint.Index = 1
+	if announced {
+		info.AuthProof = &models.ChannelAuthProof{}
+	}
+
+	return info
+}
+
+// testPolicy returns the policy of one direction of a channel
+func testPolicy(scid uint64, flags lnwire.ChanUpdateChanFlags, lastUpdate int64) *models.ChannelEdgePolicy {
+	return &models.ChannelEdgePolicy{
+		ChannelID:                 scid,
+		LastUpdate:                time.Unix(lastUpdate, 0),
+		MessageFlags:              lnwire.ChanUpdateRequiredMaxHtlc,
+		ChannelFlags:              flags,
+		TimeLockDelta:             80,
+		MinHTLC:                   1000,
+		MaxHTLC:                   990000000,
+		FeeBaseMSat:               1000,
+		FeeProportionalMillionths: 100,
+	}
+}
+
+// describeGraphFixture returns a graph covering the corner cases of lnd's
+// marshalling and the lnrpc response DescribeGraph returns for it
+func describeGraphFixture(t *testing.T) (*fakeGraph, *lnrpc.ChannelGraph) {
+	t.Helper()
+
+	const (
+		scid      = uint64(880000<<40 | 1234<<16 | 1)
+		aliasSCID = uint64(16_000_000 << 40)
+		node1Key  = "020101010101010101010101010101010101010101010101010101010101010101"
+		node2Key  = "020202020202020202020202020202020202020202020202020202020202020202"
+		chanPoint = "1111111111111111111111111111111111111111111111111111111111111111:1"
+	)
+
+	// An inbound discount followed by an unknown odd record
+	var inbound lnwire.ExtraOpaqueData
+	if err := inbound.PackRecords(&lnwire.Fee{BaseFee: -100, FeeRate: -50}); err != nil {
+		t.Fatalf("failed to pack inbound fee: %v", err)
+	}
+	inbound = append(inbound, 0xfe, 0x00, 0x01, 0x00, 0x01, 0x01, 0x2a)
+
+	// The first policy belongs to node 2, lnd swaps it into node2_policy
+	node1Policy := testPolicy(scid, 0, 1700000000)
+	node1Policy.ExtraOpaqueData = inbound
+	node2Policy := testPolicy(scid, lnwire.ChanUpdateDirection|lnwire.ChanUpdateDisabled, 1700000100)
+
+	graph := &fakeGraph{
+		channels: []fakeChannel{
+			{info: testEdge(scid, true), c1: node2Policy, c2: node1Policy},
+			// Only node 1 sent an update, which arrives as c2
+			{info: testEdge(aliasSCID, true), c2: testPolicy(aliasSCID, 0, 1700000200)},
+			// Unannounced channels are left out
+			{info: testEdge(aliasSCID+1, false), c1: testPolicy(aliasSCID+1, 0, 1700000300)},
+		},
+		nodes: []*models.LightningNode{
+			{
+				PubKeyBytes:          testVertex(1),
+				HaveNodeAnnouncement: true,
+				LastUpdate:           time.Unix(1700000000, 0),
+				Addresses:            []net.Addr{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9735}},
+				Color:                color.RGBA{R: 0x33, G: 0x99, B: 0xff},
+				Alias:                "<alice & bob>",
+				Features: lnwire.NewFeatureVector(lnwire.NewRawFeatureVector(
+					lnwire.TLVOnionPayloadRequired, lnwire.PaymentAddrOptional, 101), lnwire.Features),
+				// Records 3 and 13, which sort the other way round as strings
+				ExtraOpaqueData: []byte{0x03, 0x01, 0x01, 0x0d, 0x02, 0xab, 0xcd},
+			},
+			// A shell node only known from a channel announcement
+			{
+				PubKeyBytes: testVertex(2),
+				LastUpdate:  time.Unix(0, 0),
+			},
+		},
+	}
+
+	policy := func(lastUpdate uint32) *lnrpc.RoutingPolicy {
+		return &lnrpc.RoutingPolicy{
+			TimeLockDelta:    80,
+			MinHtlc:          1000,
+			MaxHtlcMsat:      990000000,
+			FeeBaseMsat:      1000,
+			FeeRateMilliMsat: 100,
+			LastUpdate:       lastUpdate,
+		}
+	}
+
+	inboundPolicy := policy(1700000000)
+	inboundPolicy.CustomRecords = map[uint64][]byte{55555: {0xff, 0xff, 0xff, 0x9c, 0xff, 0xff, 0xff, 0xce}, 65537: {0x2a}}
+	inboundPolicy.InboundFeeBaseMsat = -100
+	inboundPolicy.InboundFeeRateMilliMsat = -50
+	disabledPolicy := policy(1700000100)
+	disabledPolicy.Disabled = true
+
+	want := &lnrpc.ChannelGraph{
+		Nodes: []*lnrpc.LightningNode{
+			{
+				LastUpdate: 1700000000,
+				PubKey:     node1Key,
+				Alias:      "<alice & bob>",
+				Addresses:  []*lnrpc.NodeAddress{{Network: "tcp", Addr: "192.0.2.1:9735"}},
+				Color:      "#3399ff",
+				Features: map[uint32]*lnrpc.Feature{
+					8:   {Name: "tlv-onion", IsRequired: true, IsKnown: true},
+					15:  {Name: "payment-addr", IsKnown: true},
+					101: {Name: "unknown"},
+				},
+				CustomRecords: map[uint64][]byte{3: {0x01}, 13: {0xab, 0xcd}},
+			},
+			{
+				PubKey:    node2Key,
+				Addresses: []*lnrpc.NodeAddress{},
+				Color:     "#000000",
+			},
+		},
+		Edges: []*lnrpc.ChannelEdge{
+			{
+				ChannelId:   scid,
+				ChanPoint:   chanPoint,
+				LastUpdate:  1700000100,
+				Node1Pub:    node1Key,
+				Node2Pub:    node2Key,
+				Capacity:    1000000,
+				Node1Policy: inboundPolicy,
+				Node2Policy: disabledPolicy,
+			},
+			{
+				ChannelId:   aliasSCID,
+				ChanPoint:   chanPoint,
+				LastUpdate:  1700000200,
+				Node1Pub:    node1Key,
+				Node2Pub:    node2Key,
+				Capacity:    1000000,
+				Node1Policy: policy(1700000200),
+			},
+		},
+	}
+
+	return graph, want
+}
+
+func TestWriteDescribeGraphMatchesLncli(t *testing.T) {
+	graph, want := describeGraphFixture(t)
+
+	dir := t.TempDir()
+	if err := WriteDescribeGraph(context.Background(), graph, dir, false); err != nil {
+		t.Fatalf("WriteDescribeGraph failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, DescribeGraphFile))
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+
+	// lncli prints the protojson encoding of the response. protojson randomly
+	// varies its whitespace, so it is reindented the way lncli lays it out.
+	encoded, err := lnrpc.ProtoJSONMarshalOpts.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal lnrpc response: %v", err)
+	}
+	var compact, golden bytes.Buffer
+	if err := json.Compact(&compact, encoded); err != nil {
+		t.Fatalf("failed to compact lnrpc response: %v", err)
+	}
+	if err := json.Indent(&golden, compact.Bytes(), "", "    "); err != nil {
+		t.Fatalf("failed to indent lnrpc response: %v", err)
+	}
+	golden.WriteByte('\n')
+
+	if !bytes.Equal(got, golden.Bytes()) {
+		t.Errorf("export differs from lncli describegraph\ngot:\n%s\nwant:\n%s", got, golden.Bytes())
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Package export provides the file handling shared by the exporters.
+
+Exports are written under a temporary name next to the final file and renamed
+once complete, so readers never pick up a half-written export.
+*/
+package export
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// partialSuffix marks export files that are still being written
+const partialSuffix = ".partial"
+
+// writeFile creates path with the content written by write. The file only
+// appears under its final name once write succeeded.
+func writeFile(path string, write func(w io.Writer) error) (err error) {
+	partialPath := path + partialSuffix
+
+	file, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(partialPath)
+		}
+	}()
+
+	buffered := bufio.NewWriter(file)
+	if err := write(buffered); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, path)
+}
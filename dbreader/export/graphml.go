@@ -0,0 +1,137 @@
+/*
+Package export provides the GraphML exporter.
+
+WriteGraphML writes the network as a single undirected GraphML graph with typed
+<key> declarations, which networkx (read_graphml), igraph and Gephi load with
+their attributes.
+*/
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// GraphMLFile is the file name of the GraphML export within the output directory
+const GraphMLFile = "graph.graphml"
+
+// graphMLDocument is the <graphml> root element
+type graphMLDocument struct {
+	XMLName        xml.Name     `xml:"graphml"`
+	Namespace      string       `xml:"xmlns,attr"`
+	XSINamespace   string       `xml:"xmlns:xsi,attr"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr"`
+	Keys           []graphMLKey `xml:"key"`
+	Graph          graphMLGraph `xml:"graph"`
+}
+
+// graphMLKey declares a node or edge attribute
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+// graphMLGraph is the <graph> element holding nodes and edges
+type graphMLGraph struct {
+	ID          string           `xml:"id,attr"`
+	EdgeDefault string           `xml:"edgedefault,attr"`
+	Nodes       []graphMLElement `xml:"node"`
+	Edges       []graphMLElement `xml:"edge"`
+}
+
+// graphMLElement is a <node> or an <edge>
+type graphMLElement struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr,omitempty"`
+	Target string        `xml:"target,attr,omitempty"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// graphMLData is an attribute value of a node or edge
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the dataset as a GraphML file into dir, creating it if needed
+func WriteGraphML(dataset *Dataset, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	graph := buildNetwork(dataset)
+
+	// Node and edge attributes share names like last_update, so key ids are prefixed
+	document := graphMLDocument{
+		Namespace:      "http://graphml.graphdrawing.org/xmlns",
+		XSINamespace:   "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd",
+		Graph: graphMLGraph{
+			ID:          "lightning",
+			EdgeDefault: "undirected",
+			Nodes:       make([]graphMLElement, 0, len(graph.nodes)),
+			Edges:       make([]graphMLElement, 0, len(graph.edges)),
+		},
+	}
+	for _, attribute := range networkNodeAttributes {
+		document.Keys = append(document.Keys, graphMLKey{"n_" + attribute.name, "node", attribute.name, attribute.kind})
+	}
+	for _, attribute := range networkEdgeAttributes {
+		document.Keys = append(document.Keys, graphMLKey{"e_" + attribute.name, "edge", attribute.name, attribute.kind})
+	}
+
+	for _, node := range graph.nodes {
+		document.Graph.Nodes = append(document.Graph.Nodes, graphMLElement{
+			ID:   node.id,
+			Data: graphMLValues("n_", node.values),
+		})
+	}
+	for _, edge := range graph.edges {
+		document.Graph.Edges = append(document.Graph.Edges, graphMLElement{
+			ID:     edge.id,
+			Source: edge.source,
+			Target: edge.target,
+			Data:   graphMLValues("e_", edge.values),
+		})
+	}
+
+	path := filepath.Join(dir, GraphMLFile)
+	if err := writeFile(path, func(w io.Writer) error { return writeXML(w, document) }); err != nil {
+		return fmt.Errorf("failed to write %s: %w", GraphMLFile, err)
+	}
+
+	log.Printf("Wrote %d nodes and %d edges to %s", len(graph.nodes), len(graph.edges), path)
+	return nil
+}
+
+// graphMLValues turns attribute values into <data> elements
+func graphMLValues(keyPrefix string, values []networkValue) []graphMLData {
+	data := make([]graphMLData, len(values))
+	for i, value := range values {
+		data[i] = graphMLData{keyPrefix + value.name, value.value}
+	}
+
+	return data
+}
+
+// writeXML writes an XML declaration followed by the indented document
+func writeXML(w io.Writer, document interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
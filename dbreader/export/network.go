@@ -0,0 +1,222 @@
+/*
+Package export provides the network view shared by the GraphML and GEXF exporters.
+
+Both formats describe the same undirected graph: one node per LND node and one
+edge per channel from node 1 to node 2, with the policies of both directions
+as node1_ and node2_ prefixed edge attributes. Attribute types use the GraphML
+names (boolean, int, long, string); the GEXF writer maps int to integer.
+*/
+package export
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+	"lnd-dbreader/models"
+)
+
+// networkAttribute declares a node or edge attribute
+type networkAttribute struct {
+	name string
+	kind string
+}
+
+// networkNodeAttributes are the attributes of every node
+var networkNodeAttributes = []networkAttribute{
+	{"alias", "string"},
+	{"color", "string"},
+	{"address_types", "string"},
+	{"features", "string"},
+	{"feature_bits", "string"},
+	{"last_update", "long"},
+}
+
+// networkPolicyAttributes are written once per channel direction
+var networkPolicyAttributes = []networkAttribute{
+	{"fee_base_msat", "long"},
+	{"fee_rate_milli_msat", "long"},
+	{"time_lock_delta", "int"},
+	{"min_htlc_msat", "long"},
+	{"max_htlc_msat", "long"},
+	{"disabled", "boolean"},
+	{"last_update", "long"},
+}
+
+// networkEdgeAttributes are the attributes of every edge
+var networkEdgeAttributes = append([]networkAttribute{
+	// long is signed, alias SCIDs at or above 2^63 would not fit
+	{"short_channel_id", "string"},
+	{"capacity_sat", "long"},
+	{"chan_point", "string"},
+}, append(prefixAttributes("node1_", networkPolicyAttributes), prefixAttributes("node2_", networkPolicyAttributes)...)...)
+
+// networkValue is the value of one attribute of a node or edge
+type networkValue struct {
+	name  string
+	value string
+}
+
+// networkNode is a node of the exported network
+type networkNode struct {
+	id     string
+	label  string
+	color  string
+	values []networkValue
+}
+
+// networkEdge is a channel of the exported network
+type networkEdge struct {
+	id     string
+	source string
+	target string
+	values []networkValue
+}
+
+// network is the graph the GraphML and GEXF exporters write
+type network struct {
+	nodes []networkNode
+	edges []networkEdge
+}
+
+// buildNetwork turns the dataset into nodes and edges with their attributes.
+// Attributes without a value, like the policy of a direction that was never
+// announced, are left out.
+func buildNetwork(dataset *Dataset) *network {
+	addressTypes := make(map[string]map[string]bool)
+	for _, address := range dataset.Addresses {
+		nodeID := hex.EncodeToString(address.NodeID)
+		if addressTypes[nodeID] == nil {
+			addressTypes[nodeID] = make(map[string]bool)
+		}
+		addressTypes[nodeID][address.AddressType] = true
+	}
+
+	result := &network{}
+	known := make(map[string]bool, len(dataset.Nodes))
+	for _, node := range dataset.Nodes {
+		nodeID := hex.EncodeToString(node.NodeID)
+		known[nodeID] = true
+
+		exported := networkNode{id: nodeID, label: nodeID, color: node.RGBColor}
+		if node.Alias != "" {
+			exported.label = node.Alias
+			exported.values = append(exported.values, networkValue{"alias", node.Alias})
+		}
+		if node.RGBColor != "" {
+			exported.values = append(exported.values, networkValue{"color", node.RGBColor})
+		}
+		if types := sortedKeys(addressTypes[nodeID]); len(types) > 0 {
+			exported.values = append(exported.values, networkValue{"address_types", strings.Join(types, ",")})
+		}
+		if names, bits := featureLists(node.Features); len(bits) > 0 {
+			exported.values = append(exported.values,
+				networkValue{"features", strings.Join(names, ",")},
+				networkValue{"feature_bits", strings.Join(bits, ",")})
+		}
+		if node.LastUpdate != 0 {
+			exported.values = append(exported.values, networkValue{"last_update", strconv.FormatInt(node.LastUpdate/1000, 10)})
+		}
+
+		result.nodes = append(result.nodes, exported)
+	}
+
+	policies := make(map[uint64][2]*Policy, len(dataset.Channels))
+	for i := range dataset.Policies {
+		policy := &dataset.Policies[i]
+		pair := policies[policy.ShortChannelID]
+		pair[policy.Direction&1] = policy
+		policies[policy.ShortChannelID] = pair
+	}
+
+	for _, channel := range dataset.Channels {
+		edge := networkEdge{
+			id:     strconv.FormatUint(channel.ShortChannelID, 10),
+			source: hex.EncodeToString(channel.NodeID1),
+			target: hex.EncodeToString(channel.NodeID2),
+			values: []networkValue{
+				{"short_channel_id", strconv.FormatUint(channel.ShortChannelID, 10)},
+				{"capacity_sat", strconv.FormatInt(channel.CapacitySat, 10)},
+				{"chan_point", fmt.Sprintf("%s:%d", channel.FundingTxid, channel.FundingOutputIndex)},
+			},
+		}
+
+		for direction, policy := range policies[channel.ShortChannelID] {
+			if policy != nil {
+				edge.values = append(edge.values, policyValues(fmt.Sprintf("node%d_", direction+1), policy)...)
+			}
+		}
+
+		// Both ends have to exist as nodes, even if the graph lacks one of them
+		for _, nodeID := range []string{edge.source, edge.target} {
+			if !known[nodeID] {
+				known[nodeID] = true
+				result.nodes = append(result.nodes, networkNode{id: nodeID, label: nodeID})
+			}
+		}
+
+		result.edges = append(result.edges, edge)
+	}
+
+	return result
+}
+
+// policyValues returns the attributes of one channel direction
+func policyValues(prefix string, policy *Policy) []networkValue {
+	return []networkValue{
+		{prefix + "fee_base_msat", strconv.FormatUint(policy.FeeBaseMsat, 10)},
+		{prefix + "fee_rate_milli_msat", strconv.FormatUint(policy.FeeRateMilliMsat, 10)},
+		{prefix + "time_lock_delta", strconv.FormatUint(uint64(policy.TimeLockDelta), 10)},
+		{prefix + "min_htlc_msat", strconv.FormatUint(policy.MinHTLCMsat, 10)},
+		{prefix + "max_htlc_msat", strconv.FormatUint(policy.MaxHTLCMsat, 10)},
+		{prefix + "disabled", strconv.FormatBool(policy.Disabled)},
+		{prefix + "last_update", strconv.FormatInt(policy.LastUpdate/1000, 10)},
+	}
+}
+
+// prefixAttributes returns a copy of attributes with prefixed names
+func prefixAttributes(prefix string, attributes []networkAttribute) []networkAttribute {
+	prefixed := make([]networkAttribute, len(attributes))
+	for i, attribute := range attributes {
+		prefixed[i] = networkAttribute{prefix + attribute.name, attribute.kind}
+	}
+
+	return prefixed
+}
+
+// featureLists returns the names of the known feature bits and the numbers of
+// all bits set in a base256 encoded feature vector, ordered by bit
+func featureLists(encoded []byte) (names, bits []string) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+
+	features := lnwire.NewRawFeatureVector()
+	if err := features.DecodeBase256(bytes.NewReader(encoded), len(encoded)); err != nil {
+		return nil, nil
+	}
+
+	for _, flag := range models.DecodeFeatureFlags(features) {
+		bits = append(bits, strconv.Itoa(int(flag.Bit)))
+		if flag.Name != "unknown" {
+			names = append(names, flag.Name)
+		}
+	}
+
+	return names, bits
+}
+
+// sortedKeys returns the keys of a set in ascending order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
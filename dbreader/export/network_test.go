@@ -0,0 +1,60 @@
+package export
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBuildNetworkValuesFitDeclaredTypes(t *testing.T) {
+	// Alias SCIDs start at block 16,000,000 and have the high bit set
+	alias := uint64(16_000_000 << 40)
+	dataset := &Dataset{
+		Channels: []Channel{{
+			ShortChannelID: alias,
+			NodeID1:        []byte{0x02, 0x01},
+			NodeID2:        []byte{0x02, 0x02},
+			CapacitySat:    1000000,
+		}},
+		Policies: []Policy{{
+			ShortChannelID: alias,
+			NodeID:         []byte{0x02, 0x01},
+			FeeBaseMsat:    1000,
+			TimeLockDelta:  80,
+			MaxHTLCMsat:    990000000,
+			LastUpdate:     1700000000000,
+		}},
+	}
+
+	kinds := make(map[string]string, len(networkEdgeAttributes))
+	for _, attribute := range networkEdgeAttributes {
+		if _, ok := kinds[attribute.name]; ok {
+			t.Errorf("edge attribute %s is declared twice", attribute.name)
+		}
+		kinds[attribute.name] = attribute.kind
+	}
+
+	edges := buildNetwork(dataset).edges
+	if len(edges) != 1 {
+		t.Fatalf("got %d edges, want 1", len(edges))
+	}
+	for _, value := range edges[0].values {
+		switch kinds[value.name] {
+		case "long":
+			if _, err := strconv.ParseInt(value.value, 10, 64); err != nil {
+				t.Errorf("%s = %s does not fit the declared long", value.name, value.value)
+			}
+		case "int":
+			if _, err := strconv.ParseInt(value.value, 10, 32); err != nil {
+				t.Errorf("%s = %s does not fit the declared int", value.name, value.value)
+			}
+		case "":
+			t.Errorf("%s is not declared", value.name)
+		}
+		if value.name != "short_channel_id" && value.value == strconv.FormatUint(alias, 10) {
+			t.Errorf("%s repeats the short_channel_id", value.name)
+		}
+		if value.name == "short_channel_id" && value.value != strconv.FormatUint(alias, 10) {
+			t.Errorf("got short_channel_id %s, want %d", value.value, alias)
+		}
+	}
+}
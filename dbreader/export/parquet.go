@@ -0,0 +1,63 @@
+/*
+Package export provides the Parquet exporter.
+
+WriteParquet writes one zstd compressed Parquet file per dataset table. SCIDs
+and amounts are unsigned 64-bit integers, pubkeys and feature vectors binary
+and timestamps UTC milliseconds, so pandas, Polars, Spark and DuckDB load them
+with their native types.
+*/
+package export
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Parquet file names within the output directory
+const (
+	ParquetChannelsFile  = "channels.parquet"
+	ParquetPoliciesFile  = "policies.parquet"
+	ParquetNodesFile     = "nodes.parquet"
+	ParquetAddressesFile = "addresses.parquet"
+)
+
+// WriteParquet writes the dataset as Parquet files into dir, creating it if needed
+func WriteParquet(dataset *Dataset, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	if err := writeParquetFile(filepath.Join(dir, ParquetChannelsFile), dataset.Channels); err != nil {
+		return err
+	}
+	if err := writeParquetFile(filepath.Join(dir, ParquetPoliciesFile), dataset.Policies); err != nil {
+		return err
+	}
+	if err := writeParquetFile(filepath.Join(dir, ParquetNodesFile), dataset.Nodes); err != nil {
+		return err
+	}
+	return writeParquetFile(filepath.Join(dir, ParquetAddressesFile), dataset.Addresses)
+}
+
+// writeParquetFile writes rows into a single Parquet file
+func writeParquetFile[T any](path string, rows []T) error {
+	err := writeFile(path, func(w io.Writer) error {
+		writer := parquet.NewGenericWriter[T](w, parquet.Compression(&parquet.Zstd))
+		if _, err := writer.Write(rows); err != nil {
+			return err
+		}
+
+		return writer.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+
+	log.Printf("Wrote %d rows to %s", len(rows), path)
+	return nil
+}
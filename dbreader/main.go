@@ -2,37 +2,62 @@
 LND Database Reader v0.19.1
 
 A service that continuously reads Lightning Network Daemon (LND) channel graph data
-and synchronizes it to a MySQL database. This application is compatible with LND v0.19.1-beta
+and synchronizes it to a MySQL or PostgreSQL database, or into SQLite files. This application is compatible with LND v0.19.1-beta
 and handles the new graph database architecture introduced in that version.
 
 Features:
 - Continuous sync with configurable intervals
 - Graceful shutdown handling
-- Database lock avoidance through file copying
+- Database lock avoidance through validated copies of channel.db
 - Robust error handling and recovery
 - Batch processing for performance
 
+Usage (see cli.go):
+- lnd-dbreader [sync --loop]: initial sync, then one sync per interval (default)
+- lnd-dbreader sync --watch: initial sync, then one sync whenever channel.db changed
+- lnd-dbreader sync --once: single sync, exit status 1 on failure
+- lnd-dbreader sync --dry-run: read and count the graph without writing
+- lnd-dbreader export --format parquet: write the graph as Parquet files (see export.go)
+- lnd-dbreader export --format describegraph: write the graph as lncli describegraph JSON
+- lnd-dbreader export --format graphml|gexf: write the network for graph tools
+
 Environment Variables:
+- STORAGE_BACKEND: Database the graph is written to, "mysql", "postgres" or "sqlite" (default: mysql)
 - MYSQL_HOST: MySQL server hostname (default: lnd-dbreader-mysql)
 - MYSQL_PORT: MySQL server port (default: 3306)
 - MYSQL_USER: MySQL username (default: lnd-dbreader)
 - MYSQL_PASSWORD: MySQL password (default: lnd-dbreader)
 - MYSQL_DATABASE: MySQL database name (default: lnd-dbreader)
+- POSTGRES_HOST: PostgreSQL server hostname (default: lnd-dbreader-postgres)
+- POSTGRES_PORT: PostgreSQL server port (default: 5432)
+- POSTGRES_USER: PostgreSQL username (default: lnd-dbreader)
+- POSTGRES_PASSWORD: PostgreSQL password (default: lnd-dbreader)
+- POSTGRES_DATABASE: PostgreSQL database name (default: lnd-dbreader)
+- POSTGRES_SSLMODE: PostgreSQL sslmode connection parameter (default: disable)
+- SQLITE_DIR: Directory of the SQLite files (default: /sqlite)
+- SQLITE_FILE_PER: Write a new SQLite file every "run" or every UTC "day" (default: day)
 - LND_DB_PATH: Path to LND channel.db file (default: /data/channel.db)
 - SYNC_INTERVAL_MINUTES: Sync interval in minutes (default: 30)
+- VERIFY_SIGNATURES: Verify announcement signatures after each import (default: false)
+- DB_WORK_DIR: Directory for temporary database copies (default: /tmp)
+- ATOMIC_SYNC: Commit all tables of a sync in a single transaction (default: false)
+- SNAPSHOT_MODE: Record graph snapshots "off", every "sync" or "daily" (default: off)
+- GRAPH_EVENTS: Record the changes since the previous sync in graph_events (default: false)
+- INCREMENTAL_SYNC: Only write nodes and policies whose LastUpdate moved (default: false)
+- SYNC_TRIGGER: Start syncs on a fixed "interval" or when channel.db changes ("watch") (default: interval)
+- WATCH_QUIET_SECONDS: Quiet period after the last change before a watch sync starts (default: 30)
+- WATCH_MIN_INTERVAL_MINUTES: Minimum time between watch syncs (default: 5)
 */
 package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
@@ -40,32 +65,46 @@ import (
 	"lnd-dbreader/models"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/lightningnetwork/lnd/kvdb"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/kvdb"
+	_ "modernc.org/sqlite"
 )
 
 const (
 	// Application metadata
 	appName    = "LND Database Reader"
 	appVersion = "v0.19.1"
-	
+
 	// Default configuration values
 	defaultSyncInterval = 30 * time.Minute
 	defaultDBTimeout    = 10 * time.Second
-	
+
 	// Graph configuration
 	defaultRejectCacheSize  = 1000
 	defaultChannelCacheSize = 20000
-	
-	// Temporary file path for database copying
-	tempDatabasePath = "/tmp/channel_copy.db"
+
+	// Default directory for temporary database copies
+	defaultWorkDir = "/tmp"
 )
 
 // Config holds the application configuration
 type Config struct {
-	MySQL        MySQLConfig
-	LNDDBPath    string
-	SyncInterval time.Duration
+	StorageBackend   string
+	MySQL            MySQLConfig
+	Postgres         PostgresConfig
+	SQLite           SQLiteConfig
+	LNDDBPath        string
+	SyncInterval     time.Duration
+	VerifySignatures bool
+	WorkDir          string
+	AtomicSync       bool
+	SnapshotMode     string
+	GraphEvents      bool
+	IncrementalSync  bool
+	SyncTrigger      string
+	WatchQuiet       time.Duration
+	WatchMinInterval time.Duration
 }
 
 // MySQLConfig holds MySQL connection configuration
@@ -77,6 +116,22 @@ type MySQLConfig struct {
 	Database string
 }
 
+// PostgresConfig holds PostgreSQL connection configuration
+type PostgresConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	SSLMode  string
+}
+
+// SQLiteConfig holds the location and rotation of the SQLite files
+type SQLiteConfig struct {
+	Dir     string
+	FilePer string
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -89,12 +144,23 @@ func getEnv(key, defaultValue string) string {
 func loadConfig() *Config {
 	syncIntervalStr := getEnv("SYNC_INTERVAL_MINUTES", "30")
 	syncInterval := defaultSyncInterval
-	
+
 	if intervalMinutes, err := time.ParseDuration(syncIntervalStr + "m"); err == nil {
 		syncInterval = intervalMinutes
 	}
 
+	watchQuiet := defaultWatchQuiet
+	if quietSeconds, err := time.ParseDuration(getEnv("WATCH_QUIET_SECONDS", "30") + "s"); err == nil {
+		watchQuiet = quietSeconds
+	}
+
+	watchMinInterval := defaultWatchMinInterval
+	if minMinutes, err := time.ParseDuration(getEnv("WATCH_MIN_INTERVAL_MINUTES", "5") + "m"); err == nil {
+		watchMinInterval = minMinutes
+	}
+
 	return &Config{
+		StorageBackend: getEnv("STORAGE_BACKEND", db.BackendMySQL),
 		MySQL: MySQLConfig{
 			Host:     getEnv("MYSQL_HOST", "lnd-dbreader-mysql"),
 			Port:     getEnv("MYSQL_PORT", "3306"),
@@ -102,13 +168,34 @@ func loadConfig() *Config {
 			Password: getEnv("MYSQL_PASSWORD", "lnd-dbreader"),
 			Database: getEnv("MYSQL_DATABASE", "lnd-dbreader"),
 		},
-		LNDDBPath:    getEnv("LND_DB_PATH", "/data/channel.db"),
-		SyncInterval: syncInterval,
+		Postgres: PostgresConfig{
+			Host:     getEnv("POSTGRES_HOST", "lnd-dbreader-postgres"),
+			Port:     getEnv("POSTGRES_PORT", "5432"),
+			User:     getEnv("POSTGRES_USER", "lnd-dbreader"),
+			Password: getEnv("POSTGRES_PASSWORD", "lnd-dbreader"),
+			Database: getEnv("POSTGRES_DATABASE", "lnd-dbreader"),
+			SSLMode:  getEnv("POSTGRES_SSLMODE", "disable"),
+		},
+		SQLite: SQLiteConfig{
+			Dir:     getEnv("SQLITE_DIR", "/sqlite"),
+			FilePer: getEnv("SQLITE_FILE_PER", sqliteFilePerDay),
+		},
+		LNDDBPath:        getEnv("LND_DB_PATH", "/data/channel.db"),
+		SyncInterval:     syncInterval,
+		VerifySignatures: getEnv("VERIFY_SIGNATURES", "false") == "true",
+		WorkDir:          getEnv("DB_WORK_DIR", defaultWorkDir),
+		AtomicSync:       getEnv("ATOMIC_SYNC", "false") == "true",
+		SnapshotMode:     getEnv("SNAPSHOT_MODE", db.SnapshotOff),
+		GraphEvents:      getEnv("GRAPH_EVENTS", "false") == "true",
+		IncrementalSync:  getEnv("INCREMENTAL_SYNC", "false") == "true",
+		SyncTrigger:      getEnv("SYNC_TRIGGER", syncTriggerInterval),
+		WatchQuiet:       watchQuiet,
+		WatchMinInterval: watchMinInterval,
 	}
 }
 
 // copyDatabase creates a copy of the source database file to avoid locking issues
-func copyDatabase(src, dst string) error {
+func copyDatabase(ctx context.Context, src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %w", err)
@@ -121,53 +208,101 @@ func copyDatabase(src, dst string) error {
 	}
 	defer destFile.Close()
 
-	if _, err := io.Copy(destFile, sourceFile); err != nil {
+	if _, err := io.Copy(contextWriter{ctx: ctx, w: destFile}, sourceFile); err != nil {
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
 
 	return nil
 }
 
-// processLNDDatabase handles a single iteration of reading and importing LND data
-func processLNDDatabase(lndDbPath string, mysqlDB *sql.DB) error {
-	log.Printf("Starting LND database processing")
+// graphCopy is an opened private copy of the LND channel graph
+type graphCopy struct {
+	graph   *graphdb.ChannelGraph
+	indexes *models.KVGraphIndexes
+	closers []func()
+}
 
-	// Copy database to temporary location to avoid lock issues
-	if err := copyDatabase(lndDbPath, tempDatabasePath); err != nil {
-		return fmt.Errorf("failed to copy database: %w", err)
+// onClose registers a cleanup step; steps run in reverse order of registration
+func (c *graphCopy) onClose(fn func()) {
+	c.closers = append(c.closers, fn)
+}
+
+// Close stops the graph, removes the copy and releases the working directory lock
+func (c *graphCopy) Close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
 	}
+	c.closers = nil
+}
 
-	// Ensure temp file is cleaned up
+// openGraphCopy copies channel.db into a fresh run directory under the working
+// directory lock and opens its channel graph. The caller must Close the copy.
+func openGraphCopy(ctx context.Context, config *Config, run *db.SyncRun) (_ *graphCopy, err error) {
+	source := &graphCopy{}
 	defer func() {
-		if err := os.Remove(tempDatabasePath); err != nil {
-			log.Printf("Warning: Failed to remove temporary database file: %v", err)
+		if err != nil {
+			source.Close()
 		}
 	}()
 
+	// Keep overlapping runs from sharing the working directory
+	lockFile, err := acquireWorkDirLock(config.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock working directory: %w", err)
+	}
+	source.onClose(func() {
+		releaseWorkDirLock(lockFile)
+	})
+
+	if err := checkFreeSpace(config.WorkDir, config.LNDDBPath); err != nil {
+		return nil, err
+	}
+
+	runDir, err := newRunDir(config.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the run directory and the copy inside it are cleaned up
+	source.onClose(func() {
+		if err := os.RemoveAll(runDir); err != nil {
+			log.Printf("Warning: Failed to remove temporary database copy: %v", err)
+		}
+	})
+
+	// Copy database to temporary location to avoid lock issues
+	copyPath := filepath.Join(runDir, copyFileName)
+	err = run.TimePhase("copy", func() error {
+		return prepareDatabaseCopy(ctx, config.LNDDBPath, copyPath)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
 	log.Printf("Database copied successfully")
 
 	// Initialize LND components
-	kvdbBackend, err := kvdb.Open(kvdb.BoltBackendName, tempDatabasePath, true, defaultDBTimeout, false)
+	openStart := time.Now()
+	kvdbBackend, err := kvdb.Open(kvdb.BoltBackendName, copyPath, true, defaultDBTimeout, false)
 	if err != nil {
-		return fmt.Errorf("failed to open LND database backend: %w", err)
+		return nil, fmt.Errorf("failed to open LND database backend: %w", err)
 	}
-	defer func() {
+	source.onClose(func() {
 		if err := kvdbBackend.Close(); err != nil {
 			log.Printf("Warning: Failed to close database backend: %v", err)
 		}
-	}()
+	})
 
 	// Create channeldb instance
-	dbDir := filepath.Dir(tempDatabasePath)
-	dbInstance, err := models.Open(dbDir)
+	dbInstance, err := models.Open(runDir)
 	if err != nil {
-		return fmt.Errorf("failed to open LND database: %w", err)
+		return nil, fmt.Errorf("failed to open LND database: %w", err)
 	}
-	defer func() {
+	source.onClose(func() {
 		if err := dbInstance.Close(); err != nil {
 			log.Printf("Warning: Failed to close database instance: %v", err)
 		}
-	}()
+	})
 
 	// Create channel graph instance
 	graphConfig := &graphdb.Config{
@@ -184,50 +319,232 @@ func processLNDDatabase(lndDbPath string, mysqlDB *sql.DB) error {
 
 	graph, err := graphdb.NewChannelGraph(graphConfig, chanGraphOpts...)
 	if err != nil {
-		return fmt.Errorf("failed to create channel graph: %w", err)
+		return nil, fmt.Errorf("failed to create channel graph: %w", err)
 	}
 
 	// Start the graph
 	if err := graph.Start(); err != nil {
-		return fmt.Errorf("failed to start channel graph: %w", err)
+		return nil, fmt.Errorf("failed to start channel graph: %w", err)
 	}
-	defer func() {
+	source.onClose(func() {
 		if err := graph.Stop(); err != nil {
 			log.Printf("Warning: Failed to stop graph: %v", err)
 		}
-	}()
+	})
 
-	log.Printf("Importing data to MySQL")
+	run.Phases["open_graph"] = time.Since(openStart)
+
+	source.graph = graph
+	source.indexes = models.NewGraphIndexes(kvdbBackend)
+	return source, nil
+}
+
+// processLNDDatabase handles a single iteration of reading and importing LND data.
+// Cancelling ctx aborts the copy, the graph iteration and the running statement;
+// the open transactions are rolled back.
+func processLNDDatabase(ctx context.Context, config *Config, sink db.Sink) (err error) {
+	log.Printf("Starting LND database processing")
 
 	// Initialize database tables
-	if err := db.InitializeDatabaseTables(mysqlDB); err != nil {
+	if err := db.InitializeDatabaseTables(ctx, sink); err != nil {
 		return fmt.Errorf("failed to initialize database tables: %w", err)
 	}
 
+	// Record this run in sync_runs, whatever its outcome
+	run := db.NewSyncRun(0, time.Time{})
+	if sourceInfo, err := os.Stat(config.LNDDBPath); err == nil {
+		run = db.NewSyncRun(sourceInfo.Size(), sourceInfo.ModTime())
+	}
+	if err := db.StartSyncRun(ctx, sink, run); err != nil {
+		return fmt.Errorf("failed to record sync run: %w", err)
+	}
+	defer func() {
+		if finishErr := db.FinishSyncRun(sink, run, err); finishErr != nil {
+			log.Printf("Warning: Failed to record sync run result: %v", finishErr)
+		}
+	}()
+
+	source, err := openGraphCopy(ctx, config, run)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	graph := source.graph
+
+	log.Printf("Importing data to %s", sink.Name())
+
+	// Either every importer commits on its own, or all of them commit together
+	session := db.NewSession(sink)
+	if config.AtomicSync {
+		session, err = db.BeginAtomicSession(ctx, sink)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				if rollbackErr := session.Rollback(); rollbackErr != nil {
+					log.Printf("Warning: %v", rollbackErr)
+				}
+			}
+		}()
+	}
+
+	// The previous state has to be read before the importers overwrite it,
+	// the current one is collected by the importers
+	var previousState, currentState *db.GraphState
+	if config.GraphEvents {
+		currentState = db.NewGraphState()
+
+		log.Printf("Loading previous graph state")
+		err = run.TimePhase("previous_state", func() error {
+			previousState, err = db.LoadPreviousGraphState(ctx, session)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load previous graph state: %w", err)
+		}
+	}
+
+	// Without a filter every importer writes the whole graph
+	var filter *db.IncrementalFilter
+	if config.IncrementalSync {
+		log.Printf("Loading incremental sync state")
+		err = run.TimePhase("incremental_state", func() error {
+			filter, err = db.LoadIncrementalFilter(ctx, session)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load incremental sync state: %w", err)
+		}
+	}
+
 	// Import data in sequence
 	log.Printf("Processing channel announcements")
-	if err := db.SendChannelAnnouncements(graph, mysqlDB); err != nil {
+	err = run.TimePhase("channels", func() error {
+		return db.SendChannelAnnouncements(ctx, graph, session, filter, currentState, run.Tables)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to import channel announcements: %w", err)
 	}
 
 	log.Printf("Processing node announcements")
-	if err := db.SendNodeAnnouncements(graph, mysqlDB); err != nil {
+	err = run.TimePhase("nodes", func() error {
+		return db.SendNodeAnnouncements(ctx, graph, session, filter, currentState, run.Tables)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to import node announcements: %w", err)
 	}
 
 	log.Printf("Processing node addresses")
-	if err := db.SendNodeAddresses(graph, mysqlDB); err != nil {
+	err = run.TimePhase("addresses", func() error {
+		return db.SendNodeAddresses(ctx, graph, session, filter, run.Tables)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to import node addresses: %w", err)
 	}
 
+	// Unchanged rows still have to count as seen by this sync
+	if filter != nil {
+		log.Printf("Touching unchanged rows")
+		err = run.TimePhase("touch", func() error {
+			return db.TouchUnchanged(ctx, filter, session, run.Tables)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to touch unchanged rows: %w", err)
+		}
+	}
+
+	// Import the indexes lnd uses to reject re-announcements
+	indexes := source.indexes
+
+	log.Printf("Processing zombie channels")
+	err = run.TimePhase("zombies", func() error {
+		return db.SendZombieChannels(ctx, indexes, session, run.Tables)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import zombie channels: %w", err)
+	}
+
+	log.Printf("Processing closed channels")
+	err = run.TimePhase("closed", func() error {
+		return db.SendClosedChannels(ctx, indexes, session, run.Tables)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import closed channels: %w", err)
+	}
+
+	// Optionally prove that the imported rows are genuine gossip
+	if config.VerifySignatures {
+		log.Printf("Verifying announcement signatures")
+		err = run.TimePhase("verification", func() error {
+			summary, err := db.VerifyAnnouncements(ctx, graph, session)
+			if err == nil {
+				run.Verification = &summary
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to verify announcement signatures: %w", err)
+		}
+	}
+
+	// Everything present in the graph was touched above, the rest is gone
+	log.Printf("Marking removed channels and nodes")
+	err = run.TimePhase("removals", func() error {
+		return db.MarkRemovedEntities(ctx, session, run.DBStartedAt, run.Tables)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark removed entities: %w", err)
+	}
+
+	// Optionally record what changed since the previous sync
+	if config.GraphEvents {
+		log.Printf("Recording graph events")
+		err = run.TimePhase("events", func() error {
+			count, err := db.RecordGraphEvents(ctx, currentState, previousState, run.ID, session, run.Tables)
+			if err == nil {
+				log.Printf("Recorded %d graph events", count)
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record graph events: %w", err)
+		}
+	}
+
+	// Optionally freeze the graph membership of this sync
+	err = run.TimePhase("snapshot", func() error {
+		_, err := db.TakeGraphSnapshot(ctx, session, config.SnapshotMode, run.ID, run.Tables)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record graph snapshot: %w", err)
+	}
+
+	if err = session.Commit(); err != nil {
+		return err
+	}
+
 	log.Printf("Successfully completed data import")
 	return nil
 }
 
+// syncToStorage runs one sync into the sink the storage hands out for it
+func syncToStorage(ctx context.Context, config *Config, store *storage) error {
+	sink, finish, err := store.syncSink(time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = processLNDDatabase(ctx, config, sink)
+	finish(err)
+	return err
+}
+
 // setupGracefulShutdown sets up signal handling for graceful shutdown
 func setupGracefulShutdown() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -240,93 +557,6 @@ func setupGracefulShutdown() (context.Context, context.CancelFunc) {
 	return ctx, cancel
 }
 
-// connectToMySQL establishes and tests MySQL connection
-func connectToMySQL(config MySQLConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", 
-		config.User, config.Password, config.Host, config.Port, config.Database)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
-	}
-
-	return db, nil
-}
-
 func main() {
-	log.Printf("Starting %s %s", appName, appVersion)
-
-	// Load configuration
-	config := loadConfig()
-	
-	log.Printf("Configuration:")
-	log.Printf("  LND DB Path: %s", config.LNDDBPath)
-	log.Printf("  MySQL: %s:***@tcp(%s:%s)/%s", 
-		config.MySQL.User, config.MySQL.Host, config.MySQL.Port, config.MySQL.Database)
-	log.Printf("  Sync Interval: %v", config.SyncInterval)
-
-	// Connect to MySQL
-	mysqlDB, err := connectToMySQL(config.MySQL)
-	if err != nil {
-		log.Fatalf("MySQL connection failed: %v", err)
-	}
-	defer func() {
-		if err := mysqlDB.Close(); err != nil {
-			log.Printf("Warning: Failed to close MySQL connection: %v", err)
-		} else {
-			log.Printf("MySQL connection closed")
-		}
-	}()
-
-	log.Printf("MySQL connection established successfully")
-
-	// Set up graceful shutdown
-	ctx, cancel := setupGracefulShutdown()
-	defer cancel()
-
-	// Run initial sync
-	separator := strings.Repeat("=", 80)
-	fmt.Printf("\n%s\n", separator)
-	fmt.Printf("INITIAL SYNC - %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Printf("%s\n", separator)
-
-	if err := processLNDDatabase(config.LNDDBPath, mysqlDB); err != nil {
-		log.Printf("ERROR during initial sync: %v", err)
-		log.Printf("Will retry in %v", config.SyncInterval)
-	} else {
-		log.Printf("✅ Initial sync completed successfully!")
-	}
-
-	// Start continuous sync loop
-	ticker := time.NewTicker(config.SyncInterval)
-	defer ticker.Stop()
-
-	syncCount := 1
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("Shutdown signal received, exiting gracefully")
-			return
-
-		case <-ticker.C:
-			syncCount++
-			fmt.Printf("\n%s\n", separator)
-			fmt.Printf("SYNC #%d - %s\n", syncCount, time.Now().Format("2006-01-02 15:04:05"))
-			fmt.Printf("%s\n", separator)
-
-			if err := processLNDDatabase(config.LNDDBPath, mysqlDB); err != nil {
-				log.Printf("❌ ERROR during sync #%d: %v", syncCount, err)
-				log.Printf("Will retry in %v", config.SyncInterval)
-			} else {
-				log.Printf("✅ Sync #%d completed successfully!", syncCount)
-				log.Printf("Next sync scheduled in %v", config.SyncInterval)
-			}
-		}
-	}
-}
\ No newline at end of file
+	os.Exit(runCommand(os.Args[1:]))
+}
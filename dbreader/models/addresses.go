@@ -0,0 +1,94 @@
+/*
+Package models provides classification of LND v0.19.1 node addresses.
+
+This file maps the concrete net.Addr implementations produced by the graph
+database onto the BOLT7 address descriptor types.
+*/
+package models
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/tor"
+)
+
+// Address types as stored in node_addresses.address_type and the JSON output
+const (
+	AddressTypeIPv4   = "ipv4"
+	AddressTypeIPv6   = "ipv6"
+	AddressTypeTorV2  = "torv2"
+	AddressTypeTorV3  = "torv3"
+	AddressTypeDNS    = "dns"
+	AddressTypeOpaque = "opaque"
+)
+
+// dnsHostnameDescriptor is the BOLT7 address descriptor type of a DNS hostname.
+// LND v0.19.1 does not decode it and hands it over as lnwire.OpaqueAddrs.
+const dnsHostnameDescriptor = 5
+
+// NewCustomAddress classifies a graph address by its concrete type
+func NewCustomAddress(addr net.Addr) CustomAddress {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		addrType := AddressTypeIPv6
+		if a.IP.To4() != nil {
+			addrType = AddressTypeIPv4
+		}
+		return CustomAddress{
+			Type:    addrType,
+			Address: a.IP.String(),
+			Port:    uint16(a.Port),
+		}
+
+	case *tor.OnionAddr:
+		addrType := AddressTypeTorV3
+		if len(a.OnionService) == tor.V2Len {
+			addrType = AddressTypeTorV2
+		}
+		return CustomAddress{
+			Type:    addrType,
+			Address: a.OnionService,
+			Port:    uint16(a.Port),
+		}
+
+	case *lnwire.OpaqueAddrs:
+		if dnsAddr, ok := decodeDNSHostname(a.Payload); ok {
+			return dnsAddr
+		}
+		return CustomAddress{
+			Type:    AddressTypeOpaque,
+			Address: hex.EncodeToString(a.Payload),
+		}
+
+	default:
+		return CustomAddress{
+			Type:    AddressTypeOpaque,
+			Address: addr.String(),
+		}
+	}
+}
+
+// decodeDNSHostname parses a leading DNS hostname descriptor from an opaque payload:
+// type (1 byte), hostname length (1 byte), hostname, port (2 bytes)
+func decodeDNSHostname(payload []byte) (CustomAddress, bool) {
+	if len(payload) < 2 || payload[0] != dnsHostnameDescriptor {
+		return CustomAddress{}, false
+	}
+
+	hostnameLen := int(payload[1])
+	if hostnameLen == 0 || len(payload) < 2+hostnameLen+2 {
+		return CustomAddress{}, false
+	}
+
+	hostname := payload[2 : 2+hostnameLen]
+	port := binary.BigEndian.Uint16(payload[2+hostnameLen:])
+
+	return CustomAddress{
+		Type:    AddressTypeDNS,
+		Address: string(hostname),
+		Port:    port,
+	}, true
+}
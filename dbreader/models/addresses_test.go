@@ -0,0 +1,84 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/tor"
+)
+
+func TestNewCustomAddress(t *testing.T) {
+	onionV3 := strings.Repeat("a", 56) + ".onion"
+
+	tests := []struct {
+		name string
+		addr net.Addr
+		want CustomAddress
+	}{
+		{
+			name: "ipv4",
+			addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9735},
+			want: CustomAddress{Type: AddressTypeIPv4, Address: "192.0.2.1", Port: 9735},
+		},
+		{
+			name: "ipv6",
+			addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 9735},
+			want: CustomAddress{Type: AddressTypeIPv6, Address: "2001:db8::1", Port: 9735},
+		},
+		{
+			name: "tor v3",
+			addr: &tor.OnionAddr{OnionService: onionV3, Port: 9735},
+			want: CustomAddress{Type: AddressTypeTorV3, Address: onionV3, Port: 9735},
+		},
+		{
+			name: "dns",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x26, 0x07}},
+			want: CustomAddress{Type: AddressTypeDNS, Address: "example.com", Port: 9735},
+		},
+		{
+			name: "dns followed by other descriptors",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5, 1, 'a', 0x00, 0x50, 1, 192, 0, 2, 1, 0x26, 0x07}},
+			want: CustomAddress{Type: AddressTypeDNS, Address: "a", Port: 80},
+		},
+		{
+			name: "dns without hostname length",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5}},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "05"},
+		},
+		{
+			name: "dns with empty hostname",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5, 0, 0x26, 0x07}},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "05002607"},
+		},
+		{
+			name: "dns with truncated hostname",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5, 4, 'a', 'b'}},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "05046162"},
+		},
+		{
+			name: "dns with truncated port",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{5, 2, 'a', 'b', 0x26}},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "0502616226"},
+		},
+		{
+			name: "unknown descriptor",
+			addr: &lnwire.OpaqueAddrs{Payload: []byte{42, 0xab, 0xcd}},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "2aabcd"},
+		},
+		{
+			name: "unknown address type",
+			addr: &net.UnixAddr{Name: "/tmp/lnd.sock", Net: "unix"},
+			want: CustomAddress{Type: AddressTypeOpaque, Address: "/tmp/lnd.sock"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCustomAddress(tt.addr); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Package models provides helpers for decoding LND v0.19.1 feature vectors.
+
+This file converts lnwire feature vectors into the raw hex encoding used on
+the wire and into a list of named feature bits suitable for JSON and MySQL.
+*/
+package models
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// FeatureFlag describes a single feature bit set in a feature vector
+type FeatureFlag struct {
+	Bit      uint16 `json:"bit"`
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+}
+
+// FeaturesHex returns the base256 wire encoding of the feature vector as hex
+func FeaturesHex(features *lnwire.RawFeatureVector) string {
+	if features == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := features.EncodeBase256(&buf); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// DecodeFeatureFlags lists the bits set in the feature vector ordered by bit number.
+// Even bits are required ("it's OK to be odd"), odd bits are optional.
+func DecodeFeatureFlags(features *lnwire.RawFeatureVector) []FeatureFlag {
+	if features == nil {
+		return []FeatureFlag{}
+	}
+
+	named := lnwire.NewFeatureVector(features, lnwire.Features)
+
+	flags := make([]FeatureFlag, 0, len(named.Features()))
+	for bit := range named.Features() {
+		flags = append(flags, FeatureFlag{
+			Bit:      uint16(bit),
+			Name:     named.Name(bit),
+			Required: bit%2 == 0,
+		})
+	}
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Bit < flags[j].Bit
+	})
+
+	return flags
+}
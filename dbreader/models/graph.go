@@ -1,21 +1,30 @@
 /*
 Package models provides interfaces for working with LND v0.19.1 graph database.
 
-This file defines the ChannelGraph interface that abstracts the graph database
-operations for compatibility with different LND versions.
+This file defines the ChannelGraph and GraphIndexes interfaces that abstract the
+graph database operations for compatibility with different LND versions.
 */
 package models
 
 import (
-	"github.com/lightningnetwork/lnd/graph/db/models"
 	graphdb "github.com/lightningnetwork/lnd/graph/db"
+	"github.com/lightningnetwork/lnd/graph/db/models"
 )
 
 // ChannelGraph defines the interface for iterating over channel graph data
 type ChannelGraph interface {
 	// ForEachChannel iterates over all channels in the graph
 	ForEachChannel(func(*models.ChannelEdgeInfo, *models.ChannelEdgePolicy, *models.ChannelEdgePolicy) error) error
-	
+
 	// ForEachNode iterates over all nodes in the graph
 	ForEachNode(func(graphdb.NodeRTx) error) error
-}
\ No newline at end of file
+}
+
+// GraphIndexes defines the interface for iterating over the graph's channel indexes
+type GraphIndexes interface {
+	// ForEachZombieChannel iterates over all channels in the zombie index
+	ForEachZombieChannel(func(chanID uint64, nodeKey1, nodeKey2 [33]byte) error) error
+
+	// ForEachClosedSCID iterates over all SCIDs in the closed channel index
+	ForEachClosedSCID(func(chanID uint64) error) error
+}
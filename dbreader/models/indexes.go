@@ -0,0 +1,77 @@
+/*
+Package models provides read access to LND v0.19.1 graph indexes.
+
+The graph kvdb keeps a zombie edge index and a closed SCID index that lnd uses
+to reject re-announcements. ChannelGraph offers no way to iterate them, so
+this file reads the buckets directly through kvdb.
+*/
+package models
+
+import (
+	"encoding/binary"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+)
+
+var (
+	// Bucket names as defined by lnd's graph/db/kv_store.go
+	edgeBucket       = []byte("graph-edge")
+	zombieBucket     = []byte("zombie-index")
+	closedScidBucket = []byte("closed-scid")
+)
+
+// KVGraphIndexes reads the graph indexes from a kvdb backend
+type KVGraphIndexes struct {
+	backend kvdb.Backend
+}
+
+// NewGraphIndexes creates a GraphIndexes reader on top of the graph's kvdb backend
+func NewGraphIndexes(backend kvdb.Backend) *KVGraphIndexes {
+	return &KVGraphIndexes{backend: backend}
+}
+
+// ForEachZombieChannel iterates over all channels in the zombie index.
+// Each entry maps the big-endian channel ID to the two node pubkeys.
+func (g *KVGraphIndexes) ForEachZombieChannel(cb func(chanID uint64, nodeKey1, nodeKey2 [33]byte) error) error {
+	return kvdb.View(g.backend, func(tx kvdb.RTx) error {
+		edges := tx.ReadBucket(edgeBucket)
+		if edges == nil {
+			return nil
+		}
+
+		zombieIndex := edges.NestedReadBucket(zombieBucket)
+		if zombieIndex == nil {
+			return nil
+		}
+
+		return zombieIndex.ForEach(func(k, v []byte) error {
+			if len(k) != 8 || len(v) != 66 {
+				return nil
+			}
+
+			var nodeKey1, nodeKey2 [33]byte
+			copy(nodeKey1[:], v[:33])
+			copy(nodeKey2[:], v[33:])
+
+			return cb(binary.BigEndian.Uint64(k), nodeKey1, nodeKey2)
+		})
+	}, func() {})
+}
+
+// ForEachClosedSCID iterates over all SCIDs in the closed channel index
+func (g *KVGraphIndexes) ForEachClosedSCID(cb func(chanID uint64) error) error {
+	return kvdb.View(g.backend, func(tx kvdb.RTx) error {
+		closedScids := tx.ReadBucket(closedScidBucket)
+		if closedScids == nil {
+			return nil
+		}
+
+		return closedScids.ForEach(func(k, _ []byte) error {
+			if len(k) != 8 {
+				return nil
+			}
+
+			return cb(binary.BigEndian.Uint64(k))
+		})
+	}, func() {})
+}
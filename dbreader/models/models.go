@@ -8,11 +8,10 @@ architecture introduced in LND v0.19.1.
 package models
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net"
-	"strconv"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcwallet/walletdb"
@@ -26,6 +25,7 @@ import (
 type (
 	ChannelEdgeInfo   = models.ChannelEdgeInfo
 	ChannelEdgePolicy = models.ChannelEdgePolicy
+	ChannelAuthProof  = models.ChannelAuthProof
 	LightningNode     = models.LightningNode
 	DB                = channeldb.DB
 	ReadTx            = walletdb.ReadTx
@@ -46,6 +46,77 @@ type CustomAddress struct {
 // CustomChannelAnnouncement wraps lnwire.ChannelAnnouncement1 with custom JSON serialization
 type CustomChannelAnnouncement struct {
 	*lnwire.ChannelAnnouncement1
+
+	// HasAuthProof is set when the signatures were populated from the edge's AuthProof
+	HasAuthProof bool
+
+	// InvalidAuthProof is set when the edge's AuthProof holds a signature that
+	// cannot be parsed. The announcement then carries no signatures.
+	InvalidAuthProof bool
+}
+
+// NewCustomChannelAnnouncement rebuilds the full channel_announcement stored for an edge,
+// including its feature bits and, for announced channels, its authentication proof.
+// An unparsable proof signature is not an error; see InvalidAuthProof.
+func NewCustomChannelAnnouncement(edgeInfo *ChannelEdgeInfo) (CustomChannelAnnouncement, error) {
+	chanAnn := CustomChannelAnnouncement{
+		ChannelAnnouncement1: &lnwire.ChannelAnnouncement1{
+			ChainHash:       edgeInfo.ChainHash,
+			ShortChannelID:  lnwire.NewShortChanIDFromInt(edgeInfo.ChannelID),
+			Features:        lnwire.NewRawFeatureVector(),
+			NodeID1:         edgeInfo.NodeKey1Bytes,
+			NodeID2:         edgeInfo.NodeKey2Bytes,
+			BitcoinKey1:     edgeInfo.BitcoinKey1Bytes,
+			BitcoinKey2:     edgeInfo.BitcoinKey2Bytes,
+			ExtraOpaqueData: edgeInfo.ExtraOpaqueData,
+		},
+	}
+
+	// Edge features are stored length-prefixed, as in the wire message
+	if len(edgeInfo.Features) > 0 {
+		if err := chanAnn.Features.Decode(bytes.NewReader(edgeInfo.Features)); err != nil {
+			return chanAnn, fmt.Errorf("failed to decode channel features: %w", err)
+		}
+	}
+
+	// Private or not yet announced channels have no proof
+	proof := edgeInfo.AuthProof
+	if proof == nil {
+		return chanAnn, nil
+	}
+
+	signatures := []struct {
+		raw []byte
+		sig *lnwire.Sig
+	}{
+		{proof.NodeSig1Bytes, &chanAnn.NodeSig1},
+		{proof.NodeSig2Bytes, &chanAnn.NodeSig2},
+		{proof.BitcoinSig1Bytes, &chanAnn.BitcoinSig1},
+		{proof.BitcoinSig2Bytes, &chanAnn.BitcoinSig2},
+	}
+	for _, signature := range signatures {
+		sig, err := lnwire.NewSigFromECDSARawSignature(signature.raw)
+		if err != nil {
+			chanAnn.NodeSig1, chanAnn.NodeSig2 = lnwire.Sig{}, lnwire.Sig{}
+			chanAnn.BitcoinSig1, chanAnn.BitcoinSig2 = lnwire.Sig{}, lnwire.Sig{}
+			chanAnn.InvalidAuthProof = true
+			return chanAnn, nil
+		}
+		*signature.sig = sig
+	}
+
+	chanAnn.HasAuthProof = true
+	return chanAnn, nil
+}
+
+// SignatureHex returns the 64-byte wire encoding of a signature as hex,
+// or an empty string when the announcement carries no authentication proof
+func (c CustomChannelAnnouncement) SignatureHex(sig lnwire.Sig) string {
+	if !c.HasAuthProof {
+		return ""
+	}
+
+	return hex.EncodeToString(sig.RawBytes())
 }
 
 // Interface compliance methods for CustomChannelAnnouncement
@@ -70,20 +141,7 @@ func (c CustomNodeAnnouncement) MarshalJSON() ([]byte, error) {
 	// Parse addresses into structured format
 	customAddresses := make([]CustomAddress, len(c.Addresses))
 	for i, addr := range c.Addresses {
-		host, port, err := net.SplitHostPort(addr.String())
-		if err != nil {
-			customAddresses[i] = CustomAddress{
-				Type:    "unknown",
-				Address: addr.String(),
-			}
-		} else {
-			portUint, _ := strconv.ParseUint(port, 10, 16)
-			customAddresses[i] = CustomAddress{
-				Type:    "tcp",
-				Address: host,
-				Port:    uint16(portUint),
-			}
-		}
+		customAddresses[i] = NewCustomAddress(addr)
 	}
 
 	return json.Marshal(&struct {
@@ -92,12 +150,14 @@ func (c CustomNodeAnnouncement) MarshalJSON() ([]byte, error) {
 		Addresses []CustomAddress `json:"addresses"`
 		Timestamp uint32          `json:"timestamp"`
 		RGBColor  string          `json:"rgb_color"`
+		Features  []FeatureFlag   `json:"features"`
 	}{
 		NodeID:    hex.EncodeToString(c.NodeID[:]),
 		AliasStr:  c.Alias.String(),
 		Addresses: customAddresses,
 		Timestamp: c.Timestamp,
 		RGBColor:  fmt.Sprintf("#%02x%02x%02x", c.RGBColor.R, c.RGBColor.G, c.RGBColor.B),
+		Features:  DecodeFeatureFlags(c.Features),
 	})
 }
 
@@ -115,21 +175,31 @@ func (c CustomChannelAnnouncement) MarshalJSON() ([]byte, error) {
 	node2Bytes := c.Node2KeyBytes()
 
 	return json.Marshal(&struct {
-		ChainHash       string `json:"chain_hash"`
-		ShortChannelID  string `json:"short_channel_id"`
-		NodeID1         string `json:"node_id_1"`
-		NodeID2         string `json:"node_id_2"`
-		BitcoinKey1     string `json:"bitcoin_key_1"`
-		BitcoinKey2     string `json:"bitcoin_key_2"`
-		ExtraOpaqueData string `json:"extra_opaque_data,omitempty"`
+		NodeSignature1    string        `json:"node_signature_1,omitempty"`
+		NodeSignature2    string        `json:"node_signature_2,omitempty"`
+		BitcoinSignature1 string        `json:"bitcoin_signature_1,omitempty"`
+		BitcoinSignature2 string        `json:"bitcoin_signature_2,omitempty"`
+		Features          []FeatureFlag `json:"features"`
+		ChainHash         string        `json:"chain_hash"`
+		ShortChannelID    string        `json:"short_channel_id"`
+		NodeID1           string        `json:"node_id_1"`
+		NodeID2           string        `json:"node_id_2"`
+		BitcoinKey1       string        `json:"bitcoin_key_1"`
+		BitcoinKey2       string        `json:"bitcoin_key_2"`
+		ExtraOpaqueData   string        `json:"extra_opaque_data,omitempty"`
 	}{
-		ChainHash:       hex.EncodeToString(chainHashLE[:]),
-		ShortChannelID:  c.SCID().String(),
-		NodeID1:         hex.EncodeToString(node1Bytes[:]),
-		NodeID2:         hex.EncodeToString(node2Bytes[:]),
-		BitcoinKey1:     hex.EncodeToString(c.ChannelAnnouncement1.BitcoinKey1[:]),
-		BitcoinKey2:     hex.EncodeToString(c.ChannelAnnouncement1.BitcoinKey2[:]),
-		ExtraOpaqueData: hex.EncodeToString(c.ChannelAnnouncement1.ExtraOpaqueData),
+		NodeSignature1:    c.SignatureHex(c.NodeSig1),
+		NodeSignature2:    c.SignatureHex(c.NodeSig2),
+		BitcoinSignature1: c.SignatureHex(c.BitcoinSig1),
+		BitcoinSignature2: c.SignatureHex(c.BitcoinSig2),
+		Features:          DecodeFeatureFlags(c.Features),
+		ChainHash:         hex.EncodeToString(chainHashLE[:]),
+		ShortChannelID:    c.SCID().String(),
+		NodeID1:           hex.EncodeToString(node1Bytes[:]),
+		NodeID2:           hex.EncodeToString(node2Bytes[:]),
+		BitcoinKey1:       hex.EncodeToString(c.ChannelAnnouncement1.BitcoinKey1[:]),
+		BitcoinKey2:       hex.EncodeToString(c.ChannelAnnouncement1.BitcoinKey2[:]),
+		ExtraOpaqueData:   hex.EncodeToString(c.ChannelAnnouncement1.ExtraOpaqueData),
 	})
 }
 
@@ -0,0 +1,153 @@
+/*
+Package main provides consistent copies of the LND channel.db.
+
+LND keeps writing to channel.db while the reader runs, so a plain file copy can
+catch a page half-written and produce a torn database. This file validates
+every copy before it is handed to the graph reader and copies again if it is
+torn.
+
+The copy cannot be taken through bbolt instead, neither as a Tx.WriteTo
+snapshot nor as reads in place: bbolt takes a shared flock even to open a file
+read-only, and a running LND holds an exclusive one for as long as it runs.
+The copy therefore still needs as much free space as channel.db itself.
+
+bbolt panics instead of returning an error on some torn pages, so copies are
+validated by a child process running the hidden validate-copy command.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// validateCopyCommand is the hidden command that checks a database copy
+	validateCopyCommand = "validate-copy"
+
+	// copyLockTimeout bounds how long the consistency check waits for the lock on a copy
+	copyLockTimeout = 5 * time.Second
+
+	// rawCopyAttempts is the number of raw copies tried before giving up on a torn file
+	rawCopyAttempts = 3
+
+	// rawCopyRetryDelay is the pause between two raw copy attempts
+	rawCopyRetryDelay = 2 * time.Second
+)
+
+// contextWriter fails every write once ctx is cancelled, which aborts a long copy
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write writes p unless the context is done
+func (w contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return w.w.Write(p)
+}
+
+// prepareDatabaseCopy writes a consistent copy of src to dst
+func prepareDatabaseCopy(ctx context.Context, src, dst string) error {
+	var lastErr error
+	for attempt := 1; attempt <= rawCopyAttempts; attempt++ {
+		if err := copyDatabase(ctx, src, dst); err != nil {
+			return fmt.Errorf("failed to copy database: %w", err)
+		}
+
+		lastErr = validateDatabaseCopy(ctx, dst)
+		if lastErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Printf("Warning: Database copy attempt %d/%d is inconsistent: %v", attempt, rawCopyAttempts, lastErr)
+		if attempt < rawCopyAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rawCopyRetryDelay):
+			}
+		}
+	}
+
+	return fmt.Errorf("database copy still inconsistent after %d attempts: %w", rawCopyAttempts, lastErr)
+}
+
+// validateDatabaseCopy checks the copy at path in a child process, so that a
+// torn page which makes bbolt panic fails the attempt instead of the reader
+func validateDatabaseCopy(ctx context.Context, path string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable for the consistency check: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, validateCopyCommand, path)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The first line holds the error or the panic message, the rest is a stack trace
+		message, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		if message == "" {
+			return fmt.Errorf("consistency check failed: %w", err)
+		}
+		return fmt.Errorf("consistency check failed: %s", message)
+	}
+
+	return nil
+}
+
+// runValidateCopy implements the hidden validate-copy command run by
+// validateDatabaseCopy and reports the first problem on stderr
+func runValidateCopy(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: lnd-dbreader %s <path>\n", validateCopyCommand)
+		return exitUsage
+	}
+
+	if err := checkDatabaseFile(args[0]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	return exitSuccess
+}
+
+// checkDatabaseFile opens the file with bbolt, which verifies the meta page
+// checksums, and runs a full page consistency check over it
+func checkDatabaseFile(path string) error {
+	copyDB, err := bbolt.Open(path, 0600, &bbolt.Options{
+		ReadOnly: true,
+		Timeout:  copyLockTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open database copy: %w", err)
+	}
+	defer copyDB.Close()
+
+	return copyDB.View(func(tx *bbolt.Tx) error {
+		// Report the first problem only, the rest is usually fallout from it.
+		// The channel must be drained before the transaction ends.
+		var firstErr error
+		for err := range tx.Check() {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
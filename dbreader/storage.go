@@ -0,0 +1,214 @@
+/*
+Package main provides the storage a sync writes to.
+
+MySQL and PostgreSQL are servers the reader connects to once at startup and
+every sync writes into. SQLite needs no server: every sync writes into a .sqlite
+file under SQLITE_DIR, either a new file per run or one file per UTC day that
+the syncs of that day keep updating. Per-run files are written under a
+.partial name and only renamed once the sync succeeded, so a file with the
+final name is always a complete graph.
+*/
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lnd-dbreader/db"
+)
+
+// SQLite file rotation selected by SQLITE_FILE_PER
+const (
+	sqliteFilePerRun = "run"
+	sqliteFilePerDay = "day"
+)
+
+// partialSuffix marks per-run SQLite files whose sync has not finished
+const partialSuffix = ".partial"
+
+// storage hands out the sink every sync writes to
+type storage struct {
+	config *Config
+
+	// shared is the sink of the server backends; SQLite opens a sink per sync
+	shared db.Sink
+}
+
+// openStorage connects to the database selected by STORAGE_BACKEND. SQLite
+// only checks that its directory can be created.
+func openStorage(config *Config) (*storage, error) {
+	var (
+		sqlDB *sql.DB
+		err   error
+	)
+
+	switch config.StorageBackend {
+	case db.BackendMySQL:
+		sqlDB, err = connectToMySQL(config.MySQL)
+	case db.BackendPostgres:
+		sqlDB, err = connectToPostgres(config.Postgres)
+	case db.BackendSQLite:
+		if config.SQLite.FilePer != sqliteFilePerRun && config.SQLite.FilePer != sqliteFilePerDay {
+			return nil, fmt.Errorf("unknown SQLite file rotation %q, expected %q or %q",
+				config.SQLite.FilePer, sqliteFilePerRun, sqliteFilePerDay)
+		}
+		if err := os.MkdirAll(config.SQLite.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create SQLite directory: %w", err)
+		}
+		return &storage{config: config}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.StorageBackend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := db.NewSink(config.StorageBackend, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return &storage{config: config, shared: sink}, nil
+}
+
+// Describe names the storage in log messages
+func (s *storage) Describe() string {
+	if s.shared != nil {
+		return s.shared.Name()
+	}
+
+	return fmt.Sprintf("SQLite files in %s (one per %s)", s.config.SQLite.Dir, s.config.SQLite.FilePer)
+}
+
+// Close closes the connection of the server backends
+func (s *storage) Close() error {
+	if s.shared == nil {
+		return nil
+	}
+
+	return s.shared.DB().Close()
+}
+
+// syncSink returns the sink of a sync started at startedAt and a function the
+// sync must call with its result once it finished writing
+func (s *storage) syncSink(startedAt time.Time) (db.Sink, func(syncErr error), error) {
+	if s.shared != nil {
+		return s.shared, func(error) {}, nil
+	}
+
+	path := sqlitePath(s.config.SQLite, startedAt)
+	openPath := path
+	if s.config.SQLite.FilePer == sqliteFilePerRun {
+		openPath += partialSuffix
+	}
+
+	sqlDB, err := connectToSQLite(openPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sink, err := db.NewSink(db.BackendSQLite, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, nil, err
+	}
+
+	log.Printf("Writing to SQLite file %s", path)
+
+	finish := func(syncErr error) {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("Warning: Failed to close SQLite file: %v", err)
+		}
+		if openPath == path {
+			return
+		}
+
+		if syncErr != nil {
+			if err := os.Remove(openPath); err != nil {
+				log.Printf("Warning: Failed to remove incomplete SQLite file: %v", err)
+			}
+			return
+		}
+		if err := os.Rename(openPath, path); err != nil {
+			log.Printf("Warning: Failed to rename SQLite file: %v", err)
+		}
+	}
+
+	return sink, finish, nil
+}
+
+// sqlitePath returns the file a sync started at startedAt writes to
+func sqlitePath(config SQLiteConfig, startedAt time.Time) string {
+	name := "lnd-graph-" + startedAt.UTC().Format("2006-01-02") + ".sqlite"
+	if config.FilePer == sqliteFilePerRun {
+		name = "lnd-graph-" + startedAt.UTC().Format("2006-01-02T150405Z") + ".sqlite"
+	}
+
+	return filepath.Join(config.Dir, name)
+}
+
+// connectToMySQL establishes and tests MySQL connection
+func connectToMySQL(config MySQLConfig) (*sql.DB, error) {
+	// clientFoundRows makes an upsert report unchanged rows as affected, which
+	// the sync statistics rely on, see mysqlSink.ExecUpsert
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?clientFoundRows=true",
+		config.User, config.Password, config.Host, config.Port, config.Database)
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
+	}
+
+	return db, nil
+}
+
+// connectToPostgres establishes and tests PostgreSQL connection
+func connectToPostgres(config PostgresConfig) (*sql.DB, error) {
+	dsn := (&url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     net.JoinHostPort(config.Host, config.Port),
+		Path:     config.Database,
+		RawQuery: url.Values{"sslmode": {config.SSLMode}}.Encode(),
+	}).String()
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+
+	return db, nil
+}
+
+// connectToSQLite opens an SQLite file, creating it if it does not exist. The
+// busy timeout lets a statement wait for another connection's transaction.
+func connectToSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite file: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite file: %w", err)
+	}
+
+	return db, nil
+}
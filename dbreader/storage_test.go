@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"lnd-dbreader/db"
+)
+
+func TestSQLitePath(t *testing.T) {
+	startedAt := time.Date(2025, 3, 9, 23, 30, 5, 0, time.FixedZone("UTC-2", -2*60*60))
+
+	tests := []struct {
+		filePer string
+		want    string
+	}{
+		// The file name is in UTC, where the sync already started on the next day
+		{sqliteFilePerRun, "/data/lnd-graph-2025-03-10T013005Z.sqlite"},
+		{sqliteFilePerDay, "/data/lnd-graph-2025-03-10.sqlite"},
+	}
+
+	for _, tt := range tests {
+		if got := sqlitePath(SQLiteConfig{Dir: "/data", FilePer: tt.filePer}, startedAt); got != tt.want {
+			t.Errorf("file per %s: got %s, want %s", tt.filePer, got, tt.want)
+		}
+	}
+}
+
+// openTestStorage opens SQLite storage in a fresh directory
+func openTestStorage(t *testing.T, filePer string) *storage {
+	t.Helper()
+
+	config := &Config{
+		StorageBackend: db.BackendSQLite,
+		SQLite:         SQLiteConfig{Dir: t.TempDir(), FilePer: filePer},
+	}
+	s, err := openStorage(config)
+	if err != nil {
+		t.Fatalf("openStorage failed: %v", err)
+	}
+
+	return s
+}
+
+// runTestSync writes a table through the sink of a sync and finishes it with syncErr
+func runTestSync(t *testing.T, s *storage, startedAt time.Time, syncErr error) {
+	t.Helper()
+
+	sink, finish, err := s.syncSink(startedAt)
+	if err != nil {
+		t.Fatalf("syncSink failed: %v", err)
+	}
+	if _, err := sink.DB().Exec("CREATE TABLE IF NOT EXISTS test (id INTEGER)"); err != nil {
+		t.Fatalf("failed to write SQLite file: %v", err)
+	}
+	finish(syncErr)
+}
+
+// sqliteFiles lists the file names in the SQLite directory of s
+func sqliteFiles(t *testing.T, s *storage) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(s.config.SQLite.Dir)
+	if err != nil {
+		t.Fatalf("failed to list SQLite directory: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestSyncSinkPerRun(t *testing.T) {
+	startedAt := time.Date(2025, 3, 10, 1, 30, 5, 0, time.UTC)
+	path := "lnd-graph-2025-03-10T013005Z.sqlite"
+
+	t.Run("success", func(t *testing.T) {
+		s := openTestStorage(t, sqliteFilePerRun)
+
+		sink, finish, err := s.syncSink(startedAt)
+		if err != nil {
+			t.Fatalf("syncSink failed: %v", err)
+		}
+		if _, err := sink.DB().Exec("CREATE TABLE test (id INTEGER)"); err != nil {
+			t.Fatalf("failed to write SQLite file: %v", err)
+		}
+
+		// A sync in progress only writes the partial file
+		if got := sqliteFiles(t, s); len(got) != 1 || got[0] != path+partialSuffix {
+			t.Errorf("got files %v during the sync, want %s", got, path+partialSuffix)
+		}
+
+		finish(nil)
+		if got := sqliteFiles(t, s); len(got) != 1 || got[0] != path {
+			t.Errorf("got files %v after the sync, want %s", got, path)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		s := openTestStorage(t, sqliteFilePerRun)
+
+		runTestSync(t, s, startedAt, errors.New("sync failed"))
+		if got := sqliteFiles(t, s); len(got) != 0 {
+			t.Errorf("got files %v after the failed sync, want none", got)
+		}
+	})
+}
+
+func TestSyncSinkPerDay(t *testing.T) {
+	s := openTestStorage(t, sqliteFilePerDay)
+	path := "lnd-graph-2025-03-10.sqlite"
+
+	// The syncs of a day update the same file, whatever their result
+	runTestSync(t, s, time.Date(2025, 3, 10, 1, 0, 0, 0, time.UTC), nil)
+	runTestSync(t, s, time.Date(2025, 3, 10, 13, 0, 0, 0, time.UTC), errors.New("sync failed"))
+
+	if got := sqliteFiles(t, s); len(got) != 1 || got[0] != path {
+		t.Fatalf("got files %v, want %s", got, path)
+	}
+
+	runTestSync(t, s, time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC), nil)
+	if got := sqliteFiles(t, s); len(got) != 2 {
+		t.Errorf("got files %v, want one per day", got)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Package main provides the triggers that start the syncs of the sync loop.
+
+The interval trigger syncs every SYNC_INTERVAL_MINUTES. The watch trigger
+watches the directory of LND_DB_PATH with inotify and starts a sync once
+channel.db has changed and then stayed quiet for WATCH_QUIET_SECONDS. Two
+guards bound it: syncs are at least WATCH_MIN_INTERVAL_MINUTES apart, and a
+node that keeps writing without ever going quiet is still synced every
+SYNC_INTERVAL_MINUTES.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Sync triggers selected by SYNC_TRIGGER
+const (
+	syncTriggerInterval = "interval"
+	syncTriggerWatch    = "watch"
+)
+
+// Default guards of the watch trigger
+const (
+	defaultWatchQuiet       = 30 * time.Second
+	defaultWatchMinInterval = 5 * time.Minute
+)
+
+// syncTrigger decides when the sync loop starts its next sync
+type syncTrigger interface {
+	// Wait blocks until the next sync is due and reports false when ctx ends first
+	Wait(ctx context.Context, lastSync time.Time) bool
+
+	// Describe explains when the next sync will start, for the logs
+	Describe() string
+
+	// Close releases the resources of the trigger
+	Close() error
+}
+
+// newSyncTrigger creates the trigger configured by SYNC_TRIGGER
+func newSyncTrigger(config *Config) (syncTrigger, error) {
+	switch config.SyncTrigger {
+	case syncTriggerInterval:
+		return &intervalTrigger{interval: config.SyncInterval}, nil
+	case syncTriggerWatch:
+		return newWatchTrigger(config.LNDDBPath, config.WatchQuiet, config.WatchMinInterval, config.SyncInterval)
+	default:
+		return nil, fmt.Errorf("unknown sync trigger %q", config.SyncTrigger)
+	}
+}
+
+// intervalTrigger starts a sync a fixed interval after the previous one started
+type intervalTrigger struct {
+	interval time.Duration
+}
+
+// Wait blocks until the interval since lastSync has passed
+func (t *intervalTrigger) Wait(ctx context.Context, lastSync time.Time) bool {
+	timer := time.NewTimer(time.Until(lastSync.Add(t.interval)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Describe explains when the next sync will start
+func (t *intervalTrigger) Describe() string {
+	return fmt.Sprintf("scheduled in %v", t.interval)
+}
+
+// Close is a no-op for the interval trigger
+func (t *intervalTrigger) Close() error {
+	return nil
+}
+
+// watchSchedule holds the guards that place the syncs of the watch trigger
+type watchSchedule struct {
+	quiet       time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+}
+
+// due computes when the sync following lastSync is due. dirty reports whether
+// channel.db changed since then, lastChange when it changed last.
+func (s watchSchedule) due(lastSync, lastChange time.Time, dirty bool) time.Time {
+	latest := lastSync.Add(s.maxInterval)
+	if !dirty {
+		return latest
+	}
+
+	due := lastChange.Add(s.quiet)
+	if earliest := lastSync.Add(s.minInterval); due.Before(earliest) {
+		due = earliest
+	}
+	if due.After(latest) {
+		due = latest
+	}
+
+	return due
+}
+
+// watchTrigger starts a sync after channel.db changed and went quiet
+type watchTrigger struct {
+	watchSchedule
+
+	watcher *fsnotify.Watcher
+	target  string
+
+	mu         sync.Mutex
+	dirty      bool
+	lastChange time.Time
+
+	// changed is signalled after every relevant event, so Wait recomputes its deadline
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// newWatchTrigger watches the directory of dbPath. The directory is watched
+// instead of the file so that a replaced or recreated channel.db is noticed.
+func newWatchTrigger(dbPath string, quiet, minInterval, maxInterval time.Duration) (*watchTrigger, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	target := filepath.Clean(dbPath)
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", filepath.Dir(target), err)
+	}
+
+	t := &watchTrigger{
+		watchSchedule: watchSchedule{
+			quiet:       quiet,
+			minInterval: minInterval,
+			maxInterval: maxInterval,
+		},
+		watcher: watcher,
+		target:  target,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go t.watch()
+
+	return t, nil
+}
+
+// watch records changes of the target file until the watcher is closed
+func (t *watchTrigger) watch() {
+	defer close(t.done)
+
+	for {
+		select {
+		case event, ok := <-t.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != t.target || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			t.mu.Lock()
+			t.dirty = true
+			t.lastChange = time.Now()
+			t.mu.Unlock()
+
+			select {
+			case t.changed <- struct{}{}:
+			default:
+			}
+
+		case err, ok := <-t.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Warning: File watcher error: %v", err)
+		}
+	}
+}
+
+// nextSync computes when the sync following lastSync is due
+func (t *watchTrigger) nextSync(lastSync time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.due(lastSync, t.lastChange, t.dirty)
+}
+
+// Wait blocks until channel.db changed and stayed quiet, within the interval guards
+func (t *watchTrigger) Wait(ctx context.Context, lastSync time.Time) bool {
+	for {
+		timer := time.NewTimer(time.Until(t.nextSync(lastSync)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+
+		case <-t.changed:
+			// A new change moves the end of the quiet period
+			timer.Stop()
+
+		case <-timer.C:
+			// Changes from now on are not covered by the copy of the upcoming sync
+			t.mu.Lock()
+			t.dirty = false
+			t.mu.Unlock()
+			return true
+		}
+	}
+}
+
+// Describe explains when the next sync will start
+func (t *watchTrigger) Describe() string {
+	return fmt.Sprintf("after %s changes and stays quiet for %v (at least %v and at most %v after the last sync started)",
+		filepath.Base(t.target), t.quiet, t.minInterval, t.maxInterval)
+}
+
+// Close stops watching the directory
+func (t *watchTrigger) Close() error {
+	err := t.watcher.Close()
+	<-t.done
+	return err
+}
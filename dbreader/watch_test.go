@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchScheduleDue(t *testing.T) {
+	schedule := watchSchedule{
+		quiet:       30 * time.Second,
+		minInterval: 5 * time.Minute,
+		maxInterval: time.Hour,
+	}
+	lastSync := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return lastSync.Add(d) }
+
+	tests := []struct {
+		name       string
+		lastChange time.Time
+		dirty      bool
+		want       time.Time
+	}{
+		{
+			name: "unchanged waits for the max interval",
+			want: at(time.Hour),
+		},
+		{
+			name:       "change waits for the quiet period",
+			lastChange: at(10 * time.Minute),
+			dirty:      true,
+			want:       at(10*time.Minute + 30*time.Second),
+		},
+		{
+			name:       "quiet period ending early waits for the min interval",
+			lastChange: at(time.Minute),
+			dirty:      true,
+			want:       at(5 * time.Minute),
+		},
+		{
+			name:       "change before the last sync waits for the min interval",
+			lastChange: at(-time.Minute),
+			dirty:      true,
+			want:       at(5 * time.Minute),
+		},
+		{
+			name:       "quiet period ending after the max interval is cut short",
+			lastChange: at(time.Hour - 10*time.Second),
+			dirty:      true,
+			want:       at(time.Hour),
+		},
+		{
+			name:       "quiet period ending at the max interval",
+			lastChange: at(time.Hour - 30*time.Second),
+			dirty:      true,
+			want:       at(time.Hour),
+		},
+		{
+			name:       "stale change time is ignored while clean",
+			lastChange: at(10 * time.Minute),
+			want:       at(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.due(lastSync, tt.lastChange, tt.dirty); !got.Equal(tt.want) {
+				t.Errorf("got %v after the last sync, want %v", got.Sub(lastSync), tt.want.Sub(lastSync))
+			}
+		})
+	}
+}
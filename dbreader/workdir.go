@@ -0,0 +1,127 @@
+/*
+Package main provides management of the working directory used for database copies.
+
+Each sync copies channel.db into its own run directory below DB_WORK_DIR. An
+advisory lock on the working directory keeps overlapping runs (a second
+container, a manual run) from working at the same time, and run directories
+left behind by crashed runs are removed on startup.
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// lockFileName is the advisory lock file inside the working directory
+	lockFileName = "lnd-dbreader.lock"
+
+	// runDirPrefix prefixes the per-run directories holding database copies
+	runDirPrefix = "lnd-dbreader-run-"
+
+	// copyFileName is the name of the database copy inside a run directory
+	copyFileName = "channel_copy.db"
+
+	// freeSpaceMargin is the fraction of the source size required on top of it
+	freeSpaceMargin = 0.1
+)
+
+// acquireWorkDirLock takes an exclusive advisory lock on the working directory.
+// It fails immediately if another process holds the lock.
+func acquireWorkDirLock(workDir string) (*os.File, error) {
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+
+	lockPath := filepath.Join(workDir, lockFileName)
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lockFile.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("another sync is already using %s", workDir)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+	}
+
+	return lockFile, nil
+}
+
+// releaseWorkDirLock releases the advisory lock taken by acquireWorkDirLock
+func releaseWorkDirLock(lockFile *os.File) {
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN); err != nil {
+		log.Printf("Warning: Failed to release working directory lock: %v", err)
+	}
+	if err := lockFile.Close(); err != nil {
+		log.Printf("Warning: Failed to close lock file: %v", err)
+	}
+}
+
+// newRunDir creates a uniquely named directory for this run's database copy
+func newRunDir(workDir string) (string, error) {
+	runDir, err := os.MkdirTemp(workDir, runDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	return runDir, nil
+}
+
+// cleanupStaleCopies removes run directories left behind by crashed runs.
+// The caller must hold the working directory lock.
+func cleanupStaleCopies(workDir string) error {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read working directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), runDirPrefix) {
+			continue
+		}
+
+		stalePath := filepath.Join(workDir, entry.Name())
+		if err := os.RemoveAll(stalePath); err != nil {
+			log.Printf("Warning: Failed to remove stale copy %s: %v", stalePath, err)
+			continue
+		}
+
+		log.Printf("Removed stale database copy %s", stalePath)
+	}
+
+	return nil
+}
+
+// checkFreeSpace verifies that the working directory can hold a copy of the source file
+func checkFreeSpace(workDir, sourcePath string) error {
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source database: %w", err)
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(workDir, &stat); err != nil {
+		return fmt.Errorf("failed to stat working directory filesystem: %w", err)
+	}
+
+	available := stat.Bavail * uint64(stat.Bsize)
+	required := uint64(float64(sourceInfo.Size()) * (1 + freeSpaceMargin))
+
+	if available < required {
+		return fmt.Errorf("not enough free space in %s: %d MB available, %d MB required",
+			workDir, available/(1<<20), required/(1<<20))
+	}
+
+	return nil
+}